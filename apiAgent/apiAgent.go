@@ -3,25 +3,36 @@ package apiAgent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
-	"regexp"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	_ "github.com/joho/godotenv/autoload"
-	"github.com/sashabaranov/go-openai"
-	awsHandlers "github.com/stephen1cowley/programming-agent-server/awsHandlers"
-	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
+	buildCheck "github.com/stephen1cowley/programming-agent-server/buildCheck"
+	rateLimit "github.com/stephen1cowley/programming-agent-server/rateLimit"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
 )
 
-// msgsSchema is a single message, with role typically being "user" or "ai"
+// msgsSchema is a single message, with role typically being "user" or "ai".
+// Replies from the ai also list the compile errors of any changes which could not be made,
+// whether the app builds, how many rounds were spent fixing it, and what the turn cost.
 type msgSchema struct {
-	Role string `json:"role"`
-	Text string `json:"text"`
+	Role         string                  `json:"role"`
+	Text         string                  `json:"text"`
+	Diagnostics  []buildCheck.Diagnostic `json:"diagnostics,omitempty"`
+	BuildOK      bool                    `json:"buildOk"`
+	RepairRounds int                     `json:"repairRounds"`
+	Usage        *userStore.TurnUsage    `json:"usage,omitempty"`
 }
 
 // msgsSchema is a list of user and ai messages.
@@ -41,164 +52,148 @@ type deleteFileSchema struct {
 
 // Global variables
 const TEST_USER_ID = "123"
-const ECS_CLUSTER_NAME = "ProjectCluster2"
 
-var apiKey string
-var client openai.Client
-
-var myTools []openai.Tool
-var secretData secretSchema
-
-// APiAgent sets up the Programming Agent http server on port 80
-func ApiAgent() {
-	err := onRestart()
+// TRACE_FLUSH_TIMEOUT is the longest spent sending the last spans on shutdown
+const TRACE_FLUSH_TIMEOUT = 5 * time.Second
+
+// APiAgent sets up the Programming Agent http server with the given configuration,
+// and runs it until SIGTERM or SIGINT, when it finishes the requests in progress before returning
+func ApiAgent(config *appConfig.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// A second signal exits immediately, without waiting for requests to finish
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	shutdownTracing, err := appTrace.Setup(ctx, config.Trace, config.Environment)
 	if err != nil {
-		log.Fatalf("Error restarting the application, %v", err)
+		slog.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
 	}
+	// Send the spans still buffered once the requests have finished
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), TRACE_FLUSH_TIMEOUT)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("Failed to flush the traces", "error", err)
+		}
+	}()
 
-	http.Handle("/api/test/", http.HandlerFunc(apiTestHandler))
-	http.Handle("/api/message", corsMiddleware(http.HandlerFunc(apiMessageHandler)))
-	http.Handle("/api/restart", corsMiddleware(http.HandlerFunc(apiRestartHandler)))
-	http.Handle("/api/upload", corsMiddleware(http.HandlerFunc(apiUploadHandler)))
-	http.Handle("/api/imdel", corsMiddleware(http.HandlerFunc(apiImdelHandler)))
-	http.Handle("/api/reset", corsMiddleware(http.HandlerFunc(apiResetHandler)))
-
-	log.Println("Server listening on :80")
-	err = http.ListenAndServe(":80", nil)
-	if err != nil {
-		log.Fatalf("Error starting server on :80: %v\n", err)
-	}
-}
-
-// onRestart initializes a variety of different variables and AWS settings, upon reloading the frontend
-func onRestart() error {
-	// Load the Shared AWS Configuration (~/.aws/config)
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-west-2"))
+	stores, err := NewStores(ctx, config)
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-		return err
-	}
-
-	awsHandlers.InitDynamo(cfg)
-
-	// Concurrently create an S3 client and DynamoDB client
-	go awsHandlers.InitS3(cfg)
-
-	// Create a Secrets Manager client
-	svc := secretsmanager.NewFromConfig(cfg)
-
-	// Create the input for the GetSecretValue API call
-	input := &secretsmanager.GetSecretValueInput{
-		SecretId: aws.String("open-ai-api-key"),
+		slog.Error("Error creating the stores", "error", err)
+		os.Exit(1)
 	}
 
-	// Retrieve the secret value
-	result, err := svc.GetSecretValue(context.TODO(), input)
+	server, err := NewServer(ctx, config, stores)
 	if err != nil {
-		log.Printf("failed to retrieve secret, %v", err)
-		return err
+		slog.Error("Error starting the application", "error", err)
+		os.Exit(1)
 	}
 
-	err = json.Unmarshal([]byte(*result.SecretString), &secretData)
+	err = server.Serve(ctx)
 	if err != nil {
-		log.Printf("Failed to unmarshal secret: %v", err)
-		return err
+		slog.Error("Error running server", "addr", config.Server.Addr, "error", err)
+		os.Exit(1)
 	}
-
-	// Initialise chat variables
-	// Starting system message always prepended to list of messages
-	apiKey = secretData.OpenAIAPI
-	client = *openai.NewClient(apiKey)
-
-	myTools = []openai.Tool{funcTools.AppJSEdit, funcTools.AppCSSEdit}
-
-	// No errors on startup
-	return nil
 }
 
 // apiResetHandler initializes a variety of different variables and AWS settings, upon pressing the reset button on the frontend
-func apiResetHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) apiResetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		currUserID := r.Header.Get("username")
-		log.Println("RESET Request from user", currUserID)
+		currUserID := requestUser(r)
+		slog.InfoContext(r.Context(), "Resetting the user's project")
+
+		// The user's preview task is kept, so it must not be replaced or stopped while the user is reset
+		unlock := s.lockPreview(currUserID)
+		defer unlock()
 
 		// Get the previous UserState
-		currUserState, err := awsHandlers.DynamoGetUser(currUserID)
+		currUserState, err := s.loadUser(r.Context(), currUserID)
 		if err != nil {
 			http.Error(w, "Failed to find user of given credentials", http.StatusInternalServerError)
-			log.Printf("Failed to find user of given credentials %v\n", err)
+			slog.ErrorContext(r.Context(), "Failed to find user of given credentials", "error", err)
 			return
 		}
 
-		// Reset everything other than the UserID and the Fargate task
-		freshUserState := awsHandlers.UserState{}
+		// Remove the files the AI created from the user's preview
+		err = s.newProject(currUserState).DeleteOtherFiles(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to delete the app's files", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to delete the app's files", "error", err)
+			return
+		}
+
+		// Reset everything other than the UserID, the Fargate task and the usage
+		freshUserState := userStore.UserState{}
 		freshUserState.UserID = currUserState.UserID
 		freshUserState.FargateTaskARN = currUserState.FargateTaskARN
+		freshUserState.PreviewActiveAt = currUserState.PreviewActiveAt
+		freshUserState.Usage = currUserState.Usage
 
-		err = awsHandlers.DynamoPutUser(freshUserState)
+		err = s.Users.PutUser(r.Context(), freshUserState)
 		if err != nil {
 			http.Error(w, "Failed to reset user info", http.StatusInternalServerError)
-			log.Printf("Failed to reset user info %v", err)
+			slog.ErrorContext(r.Context(), "Failed to reset user info", "error", err)
+			return
 		}
 
-		err = awsHandlers.DeleteAllFromS3(currUserID)
+		err = blobStore.DeleteAll(r.Context(), s.Images, userFolder(currUserID))
 		if err != nil {
 			http.Error(w, "Failed to delete all images from S3", http.StatusInternalServerError)
-			log.Printf("Failed to delete all items in the S3 folder: %v\n", err)
+			slog.ErrorContext(r.Context(), "Failed to delete the user's images", "error", err)
+			return
+		}
+
+		err = blobStore.DeleteAll(r.Context(), s.AppFiles, snapshotFolder(currUserID))
+		if err != nil {
+			http.Error(w, "Failed to delete the app's history", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to delete the user's snapshots", "error", err)
 		}
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
 // apiMessageHandler formulates the query to ChatGPT and responds accordingly.
 // It is executed whenever a user sends a message to the AI.
-func apiMessageHandler(w http.ResponseWriter, r *http.Request) {
-	var editAppJSResp funcTools.ArgsAppJS
-	var editAppCSSResp funcTools.ArgsAppCSS
-
-	var currUserState *awsHandlers.UserState
-	var err error
-
+// Clients accepting text/event-stream are sent the reply as it is generated, as Server-Sent Events.
+func (s *Server) apiMessageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		currUserID := r.Header.Get("username")
-		log.Println("Request from user", currUserID)
-
-		var startSysMsg = openai.ChatCompletionMessage{
-			Role: openai.ChatMessageRoleSystem,
-			Content: `You are a helpful software engineer.
-			Currently we are working on a fresh React App boilerplate, with access to react-bootstrap, bootstrap and react-router-dom modules.
-			You are able to change App.js and App.css, for a web app which is updated live.
-		
-			The user knows nothing about computer programming.
-			Therefore you must not say what you are doing under the hood when it comes to updating code.
-			You must be helpful and polite, and always give a brief description of what the website you created should look like.
-			But remember, don't mention App.js or App.css or what you've done to the code, as this means nothing to the user!
-	
-			You also have access to an S3 bucket folder for images https://my-programming-agent-img-store.s3.eu-west-2.amazonaws.com/uploads/
-			
-			` + currUserID + "/.",
-		}
+		currUserID := requestUser(r)
 
 		// Get the previous UserState
-		currUserState, err = awsHandlers.DynamoGetUser(currUserID)
+		// A client which disconnects, or a turn which runs too long, cancels the model calls and storage requests
+		turnTimeout := seconds(s.config.Server.TurnTimeoutSeconds)
+		ctx, cancel := context.WithTimeout(r.Context(), turnTimeout)
+		defer cancel()
+		if s.config.Server.WriteTimeoutSeconds > 0 {
+			err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(turnTimeout + seconds(s.config.Server.WriteTimeoutSeconds)))
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to extend the write deadline for the turn", "error", err)
+			}
+		}
+
+		currUserState, err := s.loadUser(ctx, currUserID)
 		if err != nil {
 			http.Error(w, "Failed to find user of given credentials", http.StatusInternalServerError)
-			log.Printf("Failed to find user of given credentials %v\n", err)
+			slog.ErrorContext(ctx, "Failed to find user of given credentials", "error", err)
 			return
 		}
 
-		currUserState.DirectoryState.S3Images, err = awsHandlers.ListAllInS3("uploads/" + currUserState.UserID)
+		currUserState.DirectoryState.S3Images, err = s.Images.List(ctx, userFolder(currUserState.UserID))
 		if err != nil {
 			http.Error(w, "Error finding images", http.StatusInternalServerError)
-			log.Printf("Error finding images %v\n", err)
+			slog.ErrorContext(ctx, "Error finding images", "error", err)
 			return
 		}
-		fmt.Println("Current images are", currUserState.DirectoryState.S3Images)
+		slog.DebugContext(ctx, "Found the user's images", "count", len(currUserState.DirectoryState.S3Images))
 
 		var requestData msgsSchema
-		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || len(requestData.Messages) == 0 {
 			http.Error(w, "Error decoding request data", http.StatusBadRequest)
 			fmt.Fprintln(w, "Error decoding request data:", err)
 			return
@@ -206,133 +201,110 @@ func apiMessageHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Process data after successful unmarshalling
 		text := requestData.Messages[0].Text
-		currUserState.Messages = append(currUserState.Messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: text,
-		})
-
-		// System message at the end describing the current state of the files
-		endSysMsg := openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: currUserState.DirectoryState.CreateSysMsgState(),
-		}
 
-		// Start and end system message with user/machine communication sandwiched inbetween
-		messagesWithSys := append(append([]openai.ChatCompletionMessage{startSysMsg}, currUserState.Messages...), endSysMsg)
-		fmt.Println(messagesWithSys)
-
-		// Define a regular expression pattern to match everything between backticks
-		re := regexp.MustCompile("```[^```]+```")
-
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		resp, err := client.CreateChatCompletion(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:       openai.GPT4o,
-				Messages:    messagesWithSys,
-				Tools:       myTools,
-				Temperature: 0.8,
-				// ToolChoice: "required",
-			},
-		)
-		cancel()
-
-		if err != nil {
-			http.Error(w, "ChatCompletion error", http.StatusInternalServerError)
-			log.Printf("ChatCompletion error: %v\n", err)
+		budget := s.agent.Load().monthlyBudget
+		if spent := currUserState.Usage.Month(time.Now()).Cost; budget > 0 && spent >= budget {
+			writeQuotaExceeded(w, spent, budget)
+			slog.InfoContext(ctx, "User is over their monthly budget", "spentUsd", spent, "budgetUsd", budget)
 			return
 		}
 
-		content := resp.Choices[0].Message.Content
-
-		// Hard code a response if only tool calls were made
-		if content == "" {
-			content = "Done!"
+		if wantsStream(r) {
+			s.streamMessage(ctx, w, currUserState, text)
+			return
 		}
 
-		tool_calls := resp.Choices[0].Message.ToolCalls
-
-		fmt.Println(content)
-
-		if len(tool_calls) != 0 {
-			fmt.Println("Now making any tool calls ...")
+		result, err := s.runTurn(ctx, currUserState, text, nil)
+		var limitErr *rateLimit.LimitError
+		if errors.As(err, &limitErr) {
+			s.writeRateLimited(w, limitErr)
+			slog.InfoContext(ctx, "Turn rate limited", "error", err)
+			return
 		}
-
-		// Replace all occurrences of stuff between ```...```
-		content = re.ReplaceAllString(content, "")
-
-		for _, val := range tool_calls {
-			switch val.Function.Name {
-			case "app_js_edit_func":
-				fmt.Println("Updating App.js ...")
-				json.Unmarshal([]byte(val.Function.Arguments), &editAppJSResp)
-				awsHandlers.EditAppJS(
-					editAppJSResp.AppJSCode,
-					currUserID,
-				)
-				currUserState.DirectoryState.AppJSCode = editAppJSResp.AppJSCode
-			case "app_css_edit_func":
-				fmt.Println("Updating App.css ...")
-				json.Unmarshal([]byte(val.Function.Arguments), &editAppCSSResp)
-				awsHandlers.EditAppCSS(
-					editAppCSSResp.AppCSSCode,
-					currUserID,
-				)
-				currUserState.DirectoryState.AppCSSCode = editAppCSSResp.AppCSSCode
-			}
+		if errors.Is(err, errTurnNotSaved) {
+			http.Error(w, "Failed to save the conversation", http.StatusInternalServerError)
+			slog.ErrorContext(ctx, "Failed to save the turn", "error", err)
+			return
 		}
-
-		if len(currUserState.Messages) >= 10 {
-			currUserState.Messages = currUserState.Messages[2:]
+		if err != nil {
+			http.Error(w, "ChatCompletion error", http.StatusInternalServerError)
+			slog.ErrorContext(ctx, "Turn failed", "error", err)
+			return
 		}
 
-		currUserState.Messages = append(currUserState.Messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleAssistant,
-			Content: content,
-		})
-
 		w.Header().Set("Content-Type", "application/json")
 
-		// Update the UserState now that messages have been added and file contents changed
-		err = awsHandlers.DynamoPutUser(*currUserState)
-		if err != nil {
-			log.Printf("Failed to add fresh user %v", err)
-		}
-
 		// Create output and respond (same as input schema for now...)
-		jsonResponse := msgSchema{Role: "ai", Text: content}
+		jsonResponse := result.reply()
 		if err := json.NewEncoder(w).Encode(jsonResponse); err != nil {
 			http.Error(w, "Error encoding JSON response", http.StatusInternalServerError)
-			log.Println(w, "Error encoding JSON response", err)
+			slog.ErrorContext(ctx, "Error encoding JSON response", "error", err)
 			return
 		}
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
+// streamMessage runs a chat turn, streaming the reply tokens and file updates to the client as Server-Sent Events.
+// The final reply is sent in a "done" event, after the "saved" event once the turn is persisted.
+func (s *Server) streamMessage(ctx context.Context, w http.ResponseWriter, currUserState *userStore.UserState, text string) {
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Streaming unsupported", "error", err)
+		return
+	}
+
+	emit := func(event string, data any) {
+		if err := sse.send(event, data); err != nil {
+			slog.WarnContext(ctx, "Error sending event", "event", event, "error", err)
+		}
+	}
+
+	result, err := s.runTurn(ctx, currUserState, text, emit)
+	var limitErr *rateLimit.LimitError
+	if errors.As(err, &limitErr) {
+		emit(EVENT_ERROR, errorEvent{Error: s.limitMessage(limitErr)})
+		slog.InfoContext(ctx, "Turn rate limited", "error", err)
+		return
+	}
+	if errors.Is(err, errTurnNotSaved) {
+		emit(EVENT_ERROR, errorEvent{Error: "Failed to save the conversation"})
+		slog.ErrorContext(ctx, "Failed to save the turn", "error", err)
+		return
+	}
+	if err != nil {
+		emit(EVENT_ERROR, errorEvent{Error: "ChatCompletion error"})
+		slog.ErrorContext(ctx, "Turn failed", "error", err)
+		return
+	}
+
+	emit(EVENT_SAVED, struct{}{})
+	emit(EVENT_DONE, result.reply())
+}
+
 // apiRestartHandler handles requests that occur each time the frontend is reloaded
-func apiRestartHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) apiRestartHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPut {
-		err := onRestart()
+		err := s.Reload(r.Context())
 		if err != nil {
 			http.Error(w, "Error restarting the application", http.StatusInternalServerError)
-			log.Fatalf("Error restarting the application, %v", err)
+			slog.ErrorContext(r.Context(), "Error restarting the application, keeping the previous agent", "error", err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
 // apiImdelHandler handles requests to delete an image from S3.
-func apiImdelHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) apiImdelHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		currUserID := r.Header.Get("username")
-		log.Println("Request from user", currUserID)
+		currUserID := requestUser(r)
 
 		var deleteRequest deleteFileSchema
 		err := json.NewDecoder(r.Body).Decode(&deleteRequest)
@@ -342,24 +314,23 @@ func apiImdelHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		fileToDelete := deleteRequest.FileName
-		err = awsHandlers.DeleteFromS3(fileToDelete, currUserID)
+		err = s.Images.Delete(r.Context(), userFolder(currUserID)+filepath.Base(fileToDelete))
 		if err != nil {
 			http.Error(w, "Error deleting file", http.StatusInternalServerError)
-			log.Println("Error deleting file, ", err)
+			slog.ErrorContext(r.Context(), "Error deleting image", "error", err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
 // apiUploadHandler handles requests to upload an image from S3.
-func apiUploadHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) apiUploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		currUserID := r.Header.Get("username")
-		log.Println("Request from user", currUserID)
+		currUserID := requestUser(r)
 
 		// Parse the form with a max size of 10MB
 		err := r.ParseMultipartForm(10 << 20) // 10 MB
@@ -375,17 +346,26 @@ func apiUploadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		defer file.Close()
 
-		// Upload to S3
-		fileURL, err := awsHandlers.UploadToS3(file, handler, currUserID)
+		// Read file content
+		buffer, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Error reading the file", http.StatusBadRequest)
+			return
+		}
+
+		// Upload to the image store
+		fileKey := userFolder(currUserID) + filepath.Base(handler.Filename)
+		err = s.Images.Put(r.Context(), fileKey, buffer, http.DetectContentType(buffer))
 		if err != nil {
 			http.Error(w, "Failed to upload file to S3", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to upload image", "error", err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(fmt.Sprintf("File uploaded successfully: %s", fileURL)))
+		w.Write([]byte(fmt.Sprintf("File uploaded successfully: %s", s.Images.URL(fileKey))))
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
@@ -393,20 +373,25 @@ func apiUploadHandler(w http.ResponseWriter, r *http.Request) {
 func apiTestHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		w.WriteHeader(http.StatusOK)
-		log.Println("Test request received...")
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println(w, "Method not allowed")
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
 	}
 }
 
 // corsMiddleware adds necessary headers for CORS policy and preflight requests.
-func corsMiddleware(next http.Handler) http.Handler {
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "https://stephencowley.com")
+		w.Header().Set("Access-Control-Allow-Origin", s.config.Server.CORSOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, username")
+		allowedHeaders := "Content-Type, Authorization, " + appLog.REQUEST_ID_HEADER
+		// Without auth, the frontend names the user in the username header
+		if s.verifier == nil {
+			allowedHeaders += ", username"
+		}
+		w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		w.Header().Set("Access-Control-Expose-Headers", appLog.REQUEST_ID_HEADER)
 
 		// Handle preflight request (OPTIONS)
 		if r.Method == http.MethodOptions {
@@ -0,0 +1,374 @@
+package apiAgent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	auth "github.com/stephen1cowley/programming-agent-server/auth"
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+const TEST_USER = "alice"
+
+// Files written by the turns of testdata/script.json
+const (
+	BLUE_CSS    = "body { background: blue; }"
+	HEADER_PATH = "components/Header.js"
+)
+
+// newTestServer creates a server with in-memory users, local blob stores and the scripted model
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	config := appConfig.Default()
+	config.LLM.Provider, config.LLM.Script, config.Auth.Disabled = appConfig.LLM_PROVIDER_SCRIPTED, "testdata/script.json", true
+
+	images, err := blobStore.NewLocalStore(t.TempDir(), "http://localhost/blobs/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appFiles, err := blobStore.NewLocalStore(t.TempDir(), "http://localhost/blobs/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServer(context.Background(), config, Stores{Users: userStore.NewMemoryStore(), Images: images, AppFiles: appFiles})
+	if err != nil {
+		t.Fatalf("NewServer() = %v", err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// sendMessage posts the text to /api/message as the test user
+func sendMessage(t *testing.T, ts *httptest.Server, text string, stream bool) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(msgsSchema{Messages: []msgSchema{{Role: "user", Text: text}}})
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/message", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("username", TEST_USER)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decodeReply decodes a JSON reply, which must have only the fields of msgSchema
+func decodeReply(t *testing.T, r io.Reader) msgSchema {
+	t.Helper()
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var reply msgSchema
+	if err := decoder.Decode(&reply); err != nil {
+		t.Fatalf("reply does not match msgSchema: %v", err)
+	}
+	return reply
+}
+
+// getUser returns the stored state of the test user
+func getUser(t *testing.T, s *Server) *userStore.UserState {
+	t.Helper()
+	user, err := s.Users.GetUser(context.Background(), TEST_USER)
+	if err != nil {
+		t.Fatalf("GetUser() = %v", err)
+	}
+	return user
+}
+
+// getAppFile returns the code of one of the test user's files in the app-code store
+func getAppFile(t *testing.T, s *Server, filePath string) (string, bool) {
+	t.Helper()
+	data, err := s.AppFiles.Get(context.Background(), userFolder(TEST_USER)+filePath)
+	if errors.Is(err, blobStore.ErrNotFound) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", filePath, err)
+	}
+	return string(data), true
+}
+
+func TestMessageTurn(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	resp := sendMessage(t, ts, "Make it blue", false)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	reply := decodeReply(t, resp.Body)
+	if reply.Role != "ai" || reply.Text != "Your site now has a blue background." {
+		t.Errorf("reply = %q from %q, want the script's follow-up from ai", reply.Text, reply.Role)
+	}
+	if !reply.BuildOK || reply.RepairRounds != 0 || len(reply.Diagnostics) != 0 {
+		t.Errorf("reply build = %v after %d repairs with %v, want a clean build", reply.BuildOK, reply.RepairRounds, reply.Diagnostics)
+	}
+	if reply.Usage == nil || reply.Usage.PromptTokens == 0 {
+		t.Errorf("reply usage = %+v, want the turn's tokens", reply.Usage)
+	}
+
+	if code, _ := getAppFile(t, s, "App.css"); code != BLUE_CSS {
+		t.Errorf("stored App.css = %q, want %q", code, BLUE_CSS)
+	}
+
+	user := getUser(t, s)
+	roles := []string{}
+	for _, msg := range user.Messages {
+		roles = append(roles, msg.Role)
+	}
+	wantRoles := []string{llm.RoleUser, llm.RoleAssistant, llm.RoleTool, llm.RoleAssistant}
+	if strings.Join(roles, ",") != strings.Join(wantRoles, ",") {
+		t.Errorf("saved messages = %v, want %v", roles, wantRoles)
+	}
+	if user.DirectoryState.AppCSSCode != BLUE_CSS {
+		t.Errorf("saved App.css = %q, want %q", user.DirectoryState.AppCSSCode, BLUE_CSS)
+	}
+	if len(user.Usage.Turns) != 1 {
+		t.Errorf("saved usage has %d turns, want 1", len(user.Usage.Turns))
+	}
+
+	// The first turn snapshots the files before and after it, with their contents kept in the app-code store
+	if len(user.Snapshots) != 2 || user.SnapshotIndex != 1 {
+		t.Fatalf("saved %d snapshots at %d, want 2 at 1", len(user.Snapshots), user.SnapshotIndex)
+	}
+	snap, err := s.getSnapshot(context.Background(), TEST_USER, user.Snapshots[1].ID)
+	if err != nil {
+		t.Fatalf("getSnapshot() = %v", err)
+	}
+	if snap.AppCSSCode != BLUE_CSS || snap.Digest() != user.Snapshots[1].Digest {
+		t.Errorf("snapshot App.css = %q, want %q with the recorded digest", snap.AppCSSCode, BLUE_CSS)
+	}
+}
+
+func TestMessageTurnStream(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	resp := sendMessage(t, ts, "Add a header", true)
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	var events []string
+	var done msgSchema
+	scanner := bufio.NewScanner(resp.Body)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			events = append(events, event)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && event == EVENT_DONE {
+			done = decodeReply(t, strings.NewReader(data))
+		}
+	}
+
+	joined := strings.Join(events, ",")
+	for _, want := range []string{EVENT_TOKEN, EVENT_FILE, EVENT_SAVED + "," + EVENT_DONE} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("events = %s, want them to include %s", joined, want)
+		}
+	}
+	if strings.Contains(joined, EVENT_ERROR) {
+		t.Errorf("events = %s, want no errors", joined)
+	}
+	if done.Text != "Your site now has a header saying Welcome." || !done.BuildOK {
+		t.Errorf("done = %+v, want the script's follow-up with a clean build", done)
+	}
+
+	if _, ok := getAppFile(t, s, HEADER_PATH); !ok {
+		t.Errorf("%s was not written to the app-code store", HEADER_PATH)
+	}
+	if _, ok := getUser(t, s).DirectoryState.ReadFile(HEADER_PATH); !ok {
+		t.Errorf("%s was not saved with the user", HEADER_PATH)
+	}
+}
+
+// failingProvider fails every model call after the first few
+type failingProvider struct {
+	llm.Provider
+	succeed int
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *failingProvider) fail() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.calls > p.succeed
+}
+
+func (p *failingProvider) Chat(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	if p.fail() {
+		return nil, errors.New("provider unavailable")
+	}
+	return p.Provider.Chat(ctx, req)
+}
+
+func (p *failingProvider) ChatStream(ctx context.Context, req llm.Request, onToken func(string)) (*llm.Response, error) {
+	if p.fail() {
+		return nil, errors.New("provider unavailable")
+	}
+	return p.Provider.ChatStream(ctx, req, onToken)
+}
+
+func TestFailedTurnRollsBack(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	if resp := sendMessage(t, ts, "Make it blue", false); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first turn status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	before := getUser(t, s)
+
+	// The model's tool calls are made, but the call after them fails
+	failing := *s.agent.Load()
+	failing.provider = &failingProvider{Provider: failing.provider, succeed: 1}
+	s.agent.Store(&failing)
+
+	resp := sendMessage(t, ts, "Add a header", false)
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	if _, ok := getAppFile(t, s, HEADER_PATH); ok {
+		t.Errorf("%s was left in the app-code store", HEADER_PATH)
+	}
+	// The first turn only wrote App.css, so the App.js written by the failed turn is deleted rather than emptied
+	if code, ok := getAppFile(t, s, "App.js"); ok {
+		t.Errorf("stored App.js = %q, want it deleted", code)
+	}
+	if code, _ := getAppFile(t, s, "App.css"); code != BLUE_CSS {
+		t.Errorf("stored App.css = %q, want it kept as %q", code, BLUE_CSS)
+	}
+
+	after := getUser(t, s)
+	if len(after.Messages) != len(before.Messages) || len(after.Snapshots) != len(before.Snapshots) {
+		t.Errorf("saved %d messages and %d snapshots, want the %d and %d from before the turn",
+			len(after.Messages), len(after.Snapshots), len(before.Messages), len(before.Snapshots))
+	}
+	if _, ok := after.DirectoryState.ReadFile(HEADER_PATH); ok {
+		t.Errorf("%s was saved with the user", HEADER_PATH)
+	}
+	// The model call which succeeded is still charged
+	if len(after.Usage.Turns) != len(before.Usage.Turns)+1 {
+		t.Errorf("saved usage has %d turns, want %d", len(after.Usage.Turns), len(before.Usage.Turns)+1)
+	}
+}
+
+func TestFailedFirstTurnRollsBack(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	failing := *s.agent.Load()
+	failing.provider = &failingProvider{Provider: failing.provider, succeed: 1}
+	s.agent.Store(&failing)
+
+	resp := sendMessage(t, ts, "Add a header", false)
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	// Nothing was stored for the user before the turn, so nothing is left after it
+	keys, err := s.AppFiles.List(context.Background(), userFolder(TEST_USER))
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("stored files = %v, want none", keys)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	if resp := sendMessage(t, ts, "Make it blue", false); resp.StatusCode != http.StatusOK {
+		t.Fatalf("turn status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	move := func(path string) historySchema {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, nil)
+		req.Header.Set("username", TEST_USER)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s status = %d, want %d", path, resp.StatusCode, http.StatusOK)
+		}
+		var history historySchema
+		if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+			t.Fatal(err)
+		}
+		return history
+	}
+
+	history := move("/api/undo")
+	if history.Current != 0 || history.CanUndo || !history.CanRedo {
+		t.Errorf("history after undo = %+v, want the first snapshot with only redo", history)
+	}
+	// Undoing back to the start removes the files the turn wrote, rather than leaving them empty
+	for _, filePath := range []string{"App.js", "App.css"} {
+		if code, ok := getAppFile(t, s, filePath); ok {
+			t.Errorf("stored %s after undo = %q, want it deleted", filePath, code)
+		}
+	}
+
+	history = move("/api/redo")
+	if history.Current != 1 || !history.CanUndo || history.CanRedo {
+		t.Errorf("history after redo = %+v, want the second snapshot with only undo", history)
+	}
+	if code, _ := getAppFile(t, s, "App.css"); code != BLUE_CSS {
+		t.Errorf("stored App.css after redo = %q, want %q", code, BLUE_CSS)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s, _ := newTestServer(t)
+	handler := s.corsMiddleware(http.NotFoundHandler())
+
+	tests := []struct {
+		name         string
+		verifier     *auth.Verifier
+		wantUsername bool
+	}{
+		{"auth disabled", nil, true},
+		{"auth enabled", &auth.Verifier{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s.verifier = test.verifier
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/api/message", nil))
+
+			allowed := rec.Header().Get("Access-Control-Allow-Headers")
+			if !strings.Contains(allowed, "Authorization") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want it to include Authorization", allowed)
+			}
+			if got := strings.Contains(allowed, "username"); got != test.wantUsername {
+				t.Errorf("Access-Control-Allow-Headers = %q, want username allowed = %v", allowed, test.wantUsername)
+			}
+		})
+	}
+}
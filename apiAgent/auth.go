@@ -0,0 +1,108 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
+	auth "github.com/stephen1cowley/programming-agent-server/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userKey is the request context key of the authenticated user's ID.
+type userKey struct{}
+
+// authErrorSchema is the response to a request without a valid token.
+type authErrorSchema struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// newVerifier creates the token verifier from the auth config.
+// Tokens must be issued by auth.issuer (e.g. https://cognito-idp.<region>.amazonaws.com/<user pool ID>)
+// for auth.audience (the app client ID). The keys are read from the local JWKS file auth.jwksFile if set,
+// and otherwise fetched from auth.jwksUrl, which defaults to the issuer's /.well-known/jwks.json.
+// auth.userClaim chooses the claim holding the user ID, and auth.tokenUse whether access or ID tokens are accepted.
+// auth.disabled trusts the username header instead, for local development only.
+func newVerifier(settings appConfig.AuthConfig) (*auth.Verifier, error) {
+	if settings.Disabled {
+		slog.Warn("Authentication is disabled, so anyone can act as any user by setting the username header")
+		return nil, nil
+	}
+
+	var keys auth.KeySet
+	var err error
+	if settings.JWKSFile != "" {
+		keys, err = auth.LoadKeySetFile(settings.JWKSFile)
+	} else {
+		url := settings.JWKSURL
+		if url == "" {
+			url = strings.TrimSuffix(settings.Issuer, "/") + "/.well-known/jwks.json"
+		}
+		keys, err = auth.NewRemoteKeySet(url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newVerifier := auth.NewVerifier(settings.Issuer, settings.Audience, keys)
+	if settings.UserClaim != "" {
+		newVerifier.UserClaims = []string{settings.UserClaim}
+	}
+	if settings.TokenUse != appConfig.TOKEN_USE_ANY {
+		newVerifier.TokenUse = settings.TokenUse
+	}
+	return newVerifier, nil
+}
+
+// authMiddleware rejects requests without a valid bearer token with 401 Unauthorized,
+// and passes on the ID of the user the token was issued to
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userID string
+		if s.verifier == nil {
+			userID = r.Header.Get("username")
+		} else {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" {
+				writeUnauthorized(w, "A bearer token is required.")
+				return
+			}
+			var err error
+			userID, err = s.verifier.Verify(token)
+			if err != nil {
+				writeUnauthorized(w, "The token is not valid.")
+				slog.InfoContext(r.Context(), "Rejected token", "error", err)
+				return
+			}
+		}
+		if userID == "" {
+			writeUnauthorized(w, "No user was given.")
+			return
+		}
+		appLog.AddAttrs(r.Context(), slog.String("user", userID))
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", userID))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, userID)))
+	})
+}
+
+// requestUser returns the ID of the user authenticated by authMiddleware
+func requestUser(r *http.Request) string {
+	userID, _ := r.Context().Value(userKey{}).(string)
+	return userID
+}
+
+// writeUnauthorized responds with 401 Unauthorized, without saying exactly what was wrong with the token
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := json.NewEncoder(w).Encode(authErrorSchema{Error: "unauthorized", Message: message}); err != nil {
+		slog.Error("Error encoding JSON response", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package apiAgent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tokens of each context window kept free for the model's reply
+const COMPLETION_RESERVE_TOKENS = 4096
+
+// Roughly the longest the project brief may grow
+const MAX_BRIEF_WORDS = 250
+
+// Most bytes of conversation kept in a user's state, so it fits in a DynamoDB item alongside the app's files of up to funcTools.MAX_PROJECT_BYTES
+const MAX_HISTORY_BYTES = 128 * 1024
+
+// What is kept of the tool results of a turn too long for MAX_HISTORY_BYTES
+const OMITTED_TOOL_RESULT = "[This result was removed to save space.]"
+
+// compactHistory keeps the user's conversation within the model's context window and MAX_HISTORY_BYTES.
+// Once the conversation, system messages and tools no longer fit, the oldest turns are dropped
+// and summarised into the user's ProjectBrief, so their requirements are not forgotten.
+// The latest turn is always kept, and a turn is never split, so tool calls stay with their results.
+func (t *turn) compactHistory(ctx context.Context) {
+	currUserState := t.state
+	startSysMsg, endSysMsg := t.server.systemMessages(currUserState)
+	budget := t.agent.contextWindow - COMPLETION_RESERVE_TOKENS - llm.RequestTokens([]llm.Message{startSysMsg, endSysMsg}, t.agent.tools.Definitions())
+
+	keepFrom := historyStart(currUserState.Messages, budget, MAX_HISTORY_BYTES)
+	if keepFrom == 0 {
+		return
+	}
+	dropped := currUserState.Messages[:keepFrom]
+	slog.InfoContext(ctx, "Summarising messages into the project brief", "messages", len(dropped))
+
+	brief, err := t.summarise(ctx, currUserState.ProjectBrief, dropped)
+	if err != nil {
+		// Better a long brief than forgetting what the user asked for
+		slog.WarnContext(ctx, "Failed to summarise the conversation, keeping the user's requests verbatim", "error", err)
+		brief = appendRequests(currUserState.ProjectBrief, dropped)
+	}
+
+	currUserState.ProjectBrief = brief
+	currUserState.Messages = append([]llm.Message(nil), currUserState.Messages[keepFrom:]...)
+}
+
+// historyStart returns the index of the first message to keep, so the newest whole turns fit in the budget of tokens
+// and in maxBytes. A turn starts at a user message.
+func historyStart(messages []llm.Message, budget int, maxBytes int) int {
+	keepFrom := len(messages)
+	tokens, size := 0, 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		tokens += llm.MessageTokens(messages[i])
+		size += messageBytes(messages[i])
+		if messages[i].Role != llm.RoleUser {
+			continue
+		}
+		// Always keep the latest turn, however long
+		if (tokens > budget || size > maxBytes) && keepFrom != len(messages) {
+			break
+		}
+		keepFrom = i
+	}
+	return keepFrom
+}
+
+// messageBytes returns the size of a message's content and tool calls
+func messageBytes(msg llm.Message) int {
+	size := len(msg.Content)
+	for _, call := range msg.ToolCalls {
+		size += len(call.Name) + len(call.Arguments)
+	}
+	return size
+}
+
+// omitToolResults replaces the content of the oldest tool results with OMITTED_TOOL_RESULT
+// until the messages fit in maxBytes, or no tool results are left to remove.
+// It is for a single turn too long to keep whole, as the model's words and the user's are kept.
+func omitToolResults(messages []llm.Message, maxBytes int) []llm.Message {
+	size := 0
+	for _, msg := range messages {
+		size += messageBytes(msg)
+	}
+	for i := range messages {
+		if size <= maxBytes {
+			break
+		}
+		if messages[i].Role != llm.RoleTool || messages[i].Content == OMITTED_TOOL_RESULT {
+			continue
+		}
+		size -= len(messages[i].Content) - len(OMITTED_TOOL_RESULT)
+		messages[i].Content = OMITTED_TOOL_RESULT
+	}
+	return messages
+}
+
+// fitsContext reports whether the next model call, with the tools, fits in the model's context window.
+// If it would not, older turns are first dropped into the project brief, so a turn whose tool results
+// have grown the conversation is checked before every call rather than only once it has finished.
+func (t *turn) fitsContext(ctx context.Context, tools []llm.Tool) bool {
+	limit := t.agent.contextWindow - COMPLETION_RESERVE_TOKENS
+	if t.requestTokens(tools) <= limit {
+		return true
+	}
+	t.compactHistory(ctx)
+	return t.requestTokens(tools) <= limit
+}
+
+// requestTokens approximates the prompt tokens of the next model call with the tools
+func (t *turn) requestTokens(tools []llm.Tool) int {
+	startSysMsg, endSysMsg := t.server.systemMessages(t.state)
+	return llm.RequestTokens(append(append([]llm.Message{startSysMsg}, t.state.Messages...), endSysMsg), tools)
+}
+
+// summarise asks the model to merge the requirements in the dropped messages into the brief
+func (t *turn) summarise(ctx context.Context, brief string, dropped []llm.Message) (string, error) {
+	var transcript strings.Builder
+	if brief != "" {
+		transcript.WriteString("Current brief:\n" + brief + "\n\n")
+	}
+	transcript.WriteString("Conversation:\n" + formatTranscript(dropped))
+
+	req := llm.Request{
+		Model: t.agent.model,
+		Messages: []llm.Message{
+			{
+				Role: llm.RoleSystem,
+				Content: fmt.Sprintf(`You keep the brief of a web app being built for a user by an AI software engineer.
+					Update the current brief with everything from the conversation which still matters for building the app:
+					the user's requirements, preferences such as colours and themes, content, and any decisions made.
+					Later requests override earlier ones. Leave out greetings, code and anything which has been undone.
+					Reply with only the updated brief, as short bullet points, in at most %d words.`, MAX_BRIEF_WORDS),
+			},
+			{Role: llm.RoleUser, Content: transcript.String()},
+		},
+		Temperature: 0.2,
+	}
+
+	if err := t.acquireModelSlot(ctx); err != nil {
+		return "", err
+	}
+	defer t.server.modelSlots.Release()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	ctx, span := appTrace.Start(ctx, "llm summarise", attribute.String("llm.model", req.Model), attribute.Int("llm.messages", len(dropped)))
+	start := time.Now()
+	resp, err := t.agent.provider.Chat(ctx, req)
+	if err != nil {
+		appMetrics.ObserveModelCall(req.Model, time.Since(start), 0, 0, err)
+		appTrace.End(span, err)
+		return "", fmt.Errorf("ChatCompletion error: %w", err)
+	}
+	usage := t.countUsage(req, resp)
+	appMetrics.ObserveModelCall(req.Model, time.Since(start), usage.PromptTokens, usage.CompletionTokens, nil)
+	span.SetAttributes(attribute.Int("llm.prompt_tokens", usage.PromptTokens), attribute.Int("llm.completion_tokens", usage.CompletionTokens))
+	appTrace.End(span, nil)
+	summary := strings.TrimSpace(resp.Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("the model replied with an empty brief")
+	}
+	return summary, nil
+}
+
+// formatTranscript writes the words of the user and the AI, leaving out tool calls and their results
+func formatTranscript(messages []llm.Message) string {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		if msg.Content == "" {
+			continue
+		}
+		switch msg.Role {
+		case llm.RoleUser:
+			transcript.WriteString("User: " + msg.Content + "\n")
+		case llm.RoleAssistant:
+			transcript.WriteString("AI: " + msg.Content + "\n")
+		}
+	}
+	return transcript.String()
+}
+
+// appendRequests adds each of the user's messages to the brief as a bullet point
+func appendRequests(brief string, dropped []llm.Message) string {
+	lines := []string{}
+	if brief != "" {
+		lines = append(lines, brief)
+	}
+	for _, msg := range dropped {
+		if msg.Role == llm.RoleUser && msg.Content != "" {
+			lines = append(lines, "- "+msg.Content)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,175 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by stores and providers which can check they are reachable, for the readiness checks.
+// Dependencies which are not Pingers, such as the in-memory store, are skipped.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Values of the status of each readiness check, and of the whole report.
+// A degraded server can still handle requests, but something needs looking at.
+const (
+	HEALTH_OK       = "ok"
+	HEALTH_DEGRADED = "degraded"
+	HEALTH_FAILED   = "failed"
+	HEALTH_SKIPPED  = "skipped"
+)
+
+// checkSchema is the outcome of a single readiness check.
+type checkSchema struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// readinessSchema is the outcome of every readiness check: failed if any failed, otherwise degraded if any were, and otherwise ok.
+type readinessSchema struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Checks    map[string]checkSchema `json:"checks"`
+}
+
+// healthCache holds the last readiness report until it expires.
+type healthCache struct {
+	mu      sync.Mutex
+	report  *readinessSchema
+	expires time.Time
+}
+
+// healthzHandler reports that the process is alive, without checking its dependencies
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// readyzHandler reports whether the server can handle requests, with the status of each dependency.
+// It responds with 503 Service Unavailable if any check failed, so the load balancer stops routing to the instance,
+// but not if the server is only degraded, as it can still handle requests.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		report := s.readiness(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status == HEALTH_FAILED {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding JSON response", "error", err)
+		}
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// readiness returns the last report if it is less than health.cacheSeconds old, and otherwise runs the checks again.
+// Probes arriving while the checks run wait for their results, rather than each running them.
+func (s *Server) readiness(ctx context.Context) *readinessSchema {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.report != nil && time.Now().Before(s.health.expires) {
+		return s.health.report
+	}
+
+	// A probe which gives up must not fail the checks shared with the others
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), seconds(s.config.Health.TimeoutSeconds))
+	defer cancel()
+
+	checks := map[string]func(context.Context) checkSchema{
+		"userStore": func(ctx context.Context) checkSchema { return ping(ctx, s.Users) },
+		"images":    func(ctx context.Context) checkSchema { return ping(ctx, s.Images) },
+		"appFiles":  func(ctx context.Context) checkSchema { return ping(ctx, s.AppFiles) },
+		"previews":  func(ctx context.Context) checkSchema { return ping(ctx, s.Previews) },
+		"llm":       s.checkLLM,
+		"secret":    s.checkSecret,
+	}
+
+	report := &readinessSchema{Status: HEALTH_OK, CheckedAt: time.Now(), Checks: make(map[string]checkSchema)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			result := check(ctx)
+			result.DurationMs = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			switch result.Status {
+			case HEALTH_FAILED:
+				report.Status = HEALTH_FAILED
+				slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", result.Error)
+			case HEALTH_DEGRADED:
+				if report.Status == HEALTH_OK {
+					report.Status = HEALTH_DEGRADED
+				}
+				slog.WarnContext(ctx, "Readiness check degraded", "check", name, "error", result.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.health.report = report
+	s.health.expires = report.CheckedAt.Add(seconds(s.config.Health.CacheSeconds))
+	return report
+}
+
+// ping checks the dependency is reachable if it is a Pinger
+func ping(ctx context.Context, dependency any) checkSchema {
+	pinger, ok := dependency.(Pinger)
+	if !ok {
+		return checkSchema{Status: HEALTH_SKIPPED}
+	}
+	if err := pinger.Ping(ctx); err != nil {
+		return checkSchema{Status: HEALTH_FAILED, Error: err.Error()}
+	}
+	return checkSchema{Status: HEALTH_OK}
+}
+
+// checkLLM checks an agent has been created, and that its provider can be reached
+func (s *Server) checkLLM(ctx context.Context) checkSchema {
+	agent := s.agent.Load()
+	if agent == nil {
+		return checkSchema{Status: HEALTH_FAILED, Error: "the LLM provider has not been created"}
+	}
+	result := ping(ctx, agent.provider)
+	result.Detail = agent.model
+	return result
+}
+
+// checkSecret checks the last reload of the agent, which fetches the API key again, succeeded.
+// Otherwise the previous key is still in use, and may have been rotated, so the server is degraded:
+// taking it out of service would not help, as every instance fetches the same secret.
+func (s *Server) checkSecret(ctx context.Context) checkSchema {
+	agent := s.agent.Load()
+	if agent == nil {
+		return checkSchema{Status: HEALTH_FAILED, Error: "the API key has not been loaded"}
+	}
+	detail := fmt.Sprintf("loaded %s ago", time.Since(agent.loadedAt).Round(time.Second))
+	if failure := s.reloadFailure.Load(); failure != nil {
+		return checkSchema{
+			Status: HEALTH_DEGRADED,
+			Error:  fmt.Sprintf("reloading failed %s ago: %v", time.Since(failure.at).Round(time.Second), failure.err),
+			Detail: detail,
+		}
+	}
+	return checkSchema{Status: HEALTH_OK, Detail: detail}
+}
@@ -0,0 +1,65 @@
+package apiAgent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	readyz := func(wantCode int, wantStatus string) readinessSchema {
+		t.Helper()
+		s.health.report = nil // run the checks again
+		resp, err := ts.Client().Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report readinessSchema
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantCode || report.Status != wantStatus {
+			t.Errorf("readyz = %d %s, want %d %s", resp.StatusCode, report.Status, wantCode, wantStatus)
+		}
+		return report
+	}
+
+	report := readyz(http.StatusOK, HEALTH_OK)
+	if got := report.Checks["userStore"].Status; got != HEALTH_SKIPPED {
+		t.Errorf("in-memory user store check = %s, want %s", got, HEALTH_SKIPPED)
+	}
+
+	// A failed reload of the API key leaves the previous key in use, which still works
+	s.reloadFailure.Store(&reloadFailure{err: errors.New("AccessDeniedException"), at: time.Now()})
+	report = readyz(http.StatusOK, HEALTH_DEGRADED)
+	if got := report.Checks["secret"]; got.Status != HEALTH_DEGRADED || got.Error == "" {
+		t.Errorf("secret check = %+v, want it degraded with the error", got)
+	}
+
+	// Without a model no requests can be handled
+	s.agent.Store(nil)
+	report = readyz(http.StatusServiceUnavailable, HEALTH_FAILED)
+	if got := report.Checks["llm"].Status; got != HEALTH_FAILED {
+		t.Errorf("llm check = %s, want %s", got, HEALTH_FAILED)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	healthzHandler(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("healthz = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	recorder = httptest.NewRecorder()
+	healthzHandler(recorder, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST healthz = %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
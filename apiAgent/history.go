@@ -0,0 +1,191 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// stepsSchema is the optional body of an undo or redo request, giving how many snapshots to move by.
+type stepsSchema struct {
+	Steps int `json:"steps"`
+}
+
+// snapshotSchema describes one snapshot in the user's history.
+type snapshotSchema struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Label     string    `json:"label"`
+	Files     []string  `json:"files"`
+}
+
+// historySchema is the user's history of snapshots, oldest first.
+// Current is the index of the snapshot the app is currently at.
+type historySchema struct {
+	Snapshots []snapshotSchema `json:"snapshots"`
+	Current   int              `json:"current"`
+	CanUndo   bool             `json:"canUndo"`
+	CanRedo   bool             `json:"canRedo"`
+}
+
+// apiHistoryHandler lists the snapshots of the user's app which can be undone or redone to.
+func (s *Server) apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		currUserID := requestUser(r)
+
+		currUserState, err := s.loadUser(r.Context(), currUserID)
+		if err != nil {
+			http.Error(w, "Failed to find user of given credentials", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to find user of given credentials", "error", err)
+			return
+		}
+
+		writeHistory(w, currUserState)
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// apiUndoHandler restores the user's app to an earlier snapshot, by default the previous one.
+func (s *Server) apiUndoHandler(w http.ResponseWriter, r *http.Request) {
+	s.moveSnapshot(w, r, (*userStore.UserState).Undo)
+}
+
+// apiRedoHandler restores the user's app to a snapshot which was undone, by default the next one.
+func (s *Server) apiRedoHandler(w http.ResponseWriter, r *http.Request) {
+	s.moveSnapshot(w, r, (*userStore.UserState).Redo)
+}
+
+// moveSnapshot handles undo and redo requests, using move to choose the snapshot to restore.
+// The snapshot is restored to both the stored state and the app-code store, and the new history is returned.
+func (s *Server) moveSnapshot(w http.ResponseWriter, r *http.Request, move func(*userStore.UserState, int) (userStore.SnapshotInfo, error)) {
+	if r.Method == http.MethodPost {
+		currUserID := requestUser(r)
+
+		// An empty body moves by one snapshot
+		steps := stepsSchema{Steps: 1}
+		if err := json.NewDecoder(r.Body).Decode(&steps); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Error decoding request data", http.StatusBadRequest)
+			return
+		}
+
+		currUserState, err := s.loadUser(r.Context(), currUserID)
+		if err != nil {
+			http.Error(w, "Failed to find user of given credentials", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to find user of given credentials", "error", err)
+			return
+		}
+
+		info, err := move(currUserState, steps.Steps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		snap, err := s.getSnapshot(r.Context(), currUserID, info.ID)
+		if err != nil {
+			http.Error(w, "Failed to restore the app's files", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to get the snapshot", "snapshotId", info.ID, "error", err)
+			return
+		}
+
+		err = s.newProject(currUserState).Restore(r.Context(), snap)
+		if err != nil {
+			http.Error(w, "Failed to restore the app's files", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to restore the app's files", "error", err)
+			return
+		}
+
+		err = s.Users.PutUser(r.Context(), *currUserState)
+		if err != nil {
+			http.Error(w, "Failed to save user info", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to save user info", "error", err)
+			return
+		}
+
+		writeHistory(w, currUserState)
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// writeHistory responds with the user's history of snapshots
+func writeHistory(w http.ResponseWriter, currUserState *userStore.UserState) {
+	history := historySchema{
+		Snapshots: []snapshotSchema{},
+		Current:   currUserState.SnapshotIndex,
+		CanUndo:   currUserState.SnapshotIndex > 0,
+		CanRedo:   currUserState.SnapshotIndex < len(currUserState.Snapshots)-1,
+	}
+	for _, snap := range currUserState.Snapshots {
+		history.Snapshots = append(history.Snapshots, snapshotSchema{
+			ID:        snap.ID,
+			CreatedAt: snap.CreatedAt,
+			Label:     snap.Label,
+			Files:     snap.Files,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		http.Error(w, "Error encoding JSON response", http.StatusInternalServerError)
+		slog.Error("Error encoding JSON response", "error", err)
+	}
+}
+
+// snapshotFolder is the prefix of the files of the user's snapshots in the app-code store.
+// It is outside userFolder, so the snapshots are not served to the user's preview.
+func snapshotFolder(userID string) string {
+	return "snapshots/" + userID + "/"
+}
+
+// snapshotKey is where the files of one of the user's snapshots are kept in the app-code store
+func snapshotKey(userID string, id int) string {
+	return snapshotFolder(userID) + strconv.Itoa(id) + ".json"
+}
+
+// putSnapshot saves the files of the user's snapshot, so it can be restored later
+func (s *Server) putSnapshot(ctx context.Context, userID string, snap funcTools.Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot %d: %w", snap.ID, err)
+	}
+	if err := s.AppFiles.Put(ctx, snapshotKey(userID, snap.ID), data, "application/json"); err != nil {
+		return fmt.Errorf("failed to save snapshot %d: %w", snap.ID, err)
+	}
+	return nil
+}
+
+// getSnapshot returns the files of the user's snapshot
+func (s *Server) getSnapshot(ctx context.Context, userID string, id int) (funcTools.Snapshot, error) {
+	data, err := s.AppFiles.Get(ctx, snapshotKey(userID, id))
+	if err != nil {
+		return funcTools.Snapshot{}, fmt.Errorf("failed to get snapshot %d: %w", id, err)
+	}
+	var snap funcTools.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return funcTools.Snapshot{}, fmt.Errorf("failed to decode snapshot %d: %w", id, err)
+	}
+	return snap, nil
+}
+
+// deleteSnapshots deletes the files of snapshots which have been dropped from the user's history.
+// Failures are only logged, as the files are no longer used.
+func (s *Server) deleteSnapshots(ctx context.Context, userID string, ids []int) {
+	for _, id := range ids {
+		if err := s.AppFiles.Delete(ctx, snapshotKey(userID, id)); err != nil {
+			slog.WarnContext(ctx, "Failed to delete a dropped snapshot", "snapshotId", id, "error", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package apiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	rateLimit "github.com/stephen1cowley/programming-agent-server/rateLimit"
+)
+
+// rateLimitedSchema is the response to a request over one of the limits.
+type rateLimitedSchema struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Limit      string `json:"limit"`
+	RetryAfter int    `json:"retryAfter"` // seconds
+}
+
+// rateLimitMiddleware rejects requests from IP addresses and users which have sent too many, with 429 Too Many Requests.
+// Each route has its own limits, and a nil limiter or a rate of 0 turns off that limit.
+func (s *Server) rateLimitMiddleware(ipLimiter *rateLimit.KeyedLimiter, userLimiter *rateLimit.KeyedLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ipLimiter != nil && ipLimiter.Rate > 0 {
+			ip := s.clientIP(r)
+			if err := ipLimiter.Allow(ip); err != nil {
+				s.writeRateLimited(w, err.(*rateLimit.LimitError))
+				slog.InfoContext(r.Context(), "Rate limited IP address", "ip", ip)
+				return
+			}
+		}
+		if userLimiter != nil && userLimiter.Rate > 0 {
+			if err := userLimiter.Allow(requestUser(r)); err != nil {
+				s.writeRateLimited(w, err.(*rateLimit.LimitError))
+				slog.InfoContext(r.Context(), "Rate limited user")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client. Behind server.trustedProxies proxies, such as the load balancer,
+// it is the address that many entries from the end of X-Forwarded-For, which the last proxy added for the client it received the request from.
+// Earlier entries are sent by the client, so cannot be trusted. With no trusted proxies, it is the address of the connection.
+func (s *Server) clientIP(r *http.Request) string {
+	hops := s.config.Server.TrustedProxies
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && hops > 0 {
+		addresses := strings.Split(forwarded, ",")
+		// A request which did not pass through every proxy is limited by the earliest address there is
+		return strings.TrimSpace(addresses[max(len(addresses)-hops, 0)])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeRateLimited responds with 429 Too Many Requests, saying when to retry in the Retry-After header
+func (s *Server) writeRateLimited(w http.ResponseWriter, limitErr *rateLimit.LimitError) {
+	response := rateLimitedSchema{
+		Error:      "rate_limited",
+		Message:    s.limitMessage(limitErr),
+		Limit:      limitErr.Limit,
+		RetryAfter: limitErr.RetryAfterSeconds(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding JSON response", "error", err)
+	}
+}
+
+// limitMessage explains the limit to the user
+func (s *Server) limitMessage(limitErr *rateLimit.LimitError) string {
+	switch limitErr.Limit {
+	case s.modelSlots.Name:
+		return fmt.Sprintf("The AI is busy right now. Please try again in %d seconds.", limitErr.RetryAfterSeconds())
+	case s.previewLimiter.Name:
+		return fmt.Sprintf("You are refreshing the preview too quickly. Please try again in %d seconds.", limitErr.RetryAfterSeconds())
+	}
+	return fmt.Sprintf("You are sending messages too quickly. Please try again in %d seconds.", limitErr.RetryAfterSeconds())
+}
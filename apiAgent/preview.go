@@ -0,0 +1,202 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+	previewTask "github.com/stephen1cowley/programming-agent-server/previewTask"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// Environment variables telling a preview task whose app to serve, from which bucket and folder of the app-code store
+const (
+	PREVIEW_ENV_USER_ID = "USER_ID"
+	PREVIEW_ENV_BUCKET  = "S3_BUCKET_APP"
+	PREVIEW_ENV_PREFIX  = "APP_PREFIX"
+)
+
+// PREVIEW_STATUS_NONE is the status reported when the user has no preview task, e.g. before their first message
+// or once their idle task was stopped
+const PREVIEW_STATUS_NONE = "NONE"
+
+// PREVIEW_ACTIVITY_INTERVAL is how often a user's activity is saved while they poll their preview, so polling does not write every time
+const PREVIEW_ACTIVITY_INTERVAL = time.Minute
+
+// previewSchema is the state of the user's preview task.
+type previewSchema struct {
+	TaskARN       string     `json:"taskArn,omitempty"`
+	Status        string     `json:"status"`
+	DesiredStatus string     `json:"desiredStatus,omitempty"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	StoppedReason string     `json:"stoppedReason,omitempty"`
+	PublicIP      string     `json:"publicIp,omitempty"`
+	URL           string     `json:"url,omitempty"` // where the preview is served, once the task is running
+}
+
+// apiPreviewHandler reports the status of the user's preview task on GET, without starting one.
+// POST starts a new task, e.g. once the previous one has stopped, and stops the previous one.
+func (s *Server) apiPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		if s.Previews == nil {
+			http.Error(w, "Previews are not run by this server", http.StatusNotImplemented)
+			return
+		}
+		currUserID := requestUser(r)
+
+		var task *previewTask.Task
+		var err error
+		if r.Method == http.MethodPost {
+			task, err = s.startPreview(r.Context(), currUserID, true)
+		} else {
+			task, err = s.previewStatus(r.Context(), currUserID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to get the preview", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to get the preview", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse := previewSchema{Status: PREVIEW_STATUS_NONE}
+		if task != nil {
+			jsonResponse = previewSchema{
+				TaskARN:       task.ARN,
+				Status:        task.Status,
+				DesiredStatus: task.DesiredStatus,
+				StartedAt:     task.StartedAt,
+				StoppedReason: task.StoppedReason,
+				PublicIP:      task.PublicIP,
+			}
+			if task.Status == previewTask.STATUS_RUNNING && task.PublicIP != "" {
+				jsonResponse.URL = "http://" + task.PublicIP + "/"
+			}
+		}
+		if err := json.NewEncoder(w).Encode(jsonResponse); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding JSON response", "error", err)
+		}
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// previewStatus returns the user's preview task, or nil if they have none, and notes that the user is active
+func (s *Server) previewStatus(ctx context.Context, userID string) (*previewTask.Task, error) {
+	unlock := s.lockPreview(userID)
+	defer unlock()
+
+	currUserState, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currUserState.FargateTaskARN == "" {
+		return nil, nil
+	}
+
+	if time.Since(currUserState.PreviewActiveAt) >= PREVIEW_ACTIVITY_INTERVAL {
+		currUserState.PreviewActiveAt = time.Now()
+		if err := s.Users.PutUser(ctx, *currUserState); err != nil {
+			slog.WarnContext(ctx, "Failed to save the user's preview activity", "error", err)
+		}
+	}
+
+	task, err := s.Previews.Describe(ctx, currUserState.FargateTaskARN)
+	if errors.Is(err, previewTask.ErrTaskNotFound) {
+		return &previewTask.Task{ARN: currUserState.FargateTaskARN, Status: previewTask.STATUS_STOPPED, DesiredStatus: previewTask.STATUS_STOPPED}, nil
+	}
+	return task, err
+}
+
+// startPreview starts a new preview task for the user, if they have none or replace is set, and returns it.
+// Otherwise it returns nil, leaving the user's task as it is.
+// The new task's ARN is saved before the previous task is stopped, so a failure leaves the user with a running task.
+func (s *Server) startPreview(ctx context.Context, userID string, replace bool) (*previewTask.Task, error) {
+	unlock := s.lockPreview(userID)
+	defer unlock()
+
+	currUserState, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	previous := currUserState.FargateTaskARN
+	if previous != "" && !replace {
+		return nil, nil
+	}
+
+	// A task which is started must be saved, or nothing would ever stop it, so a client disconnecting cannot cancel this
+	ctx = context.WithoutCancel(ctx)
+	start := time.Now()
+	taskARN, err := s.Previews.Start(ctx, userID, s.previewEnv(userID))
+	appMetrics.ObservePreviewStart(time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+
+	currUserState.FargateTaskARN = taskARN
+	currUserState.PreviewActiveAt = time.Now()
+	if err := s.Users.PutUser(ctx, *currUserState); err != nil {
+		if stopErr := s.Previews.Stop(ctx, taskARN, "Its user could not be saved"); stopErr != nil {
+			slog.ErrorContext(ctx, "Failed to stop the preview task which could not be saved", "taskArn", taskARN, "error", stopErr)
+		}
+		return nil, err
+	}
+
+	if previous != "" {
+		if err := s.Previews.Stop(ctx, previous, "Replaced by a new preview task"); err != nil {
+			slog.WarnContext(ctx, "Failed to stop the previous preview task", "taskArn", previous, "error", err)
+		}
+	}
+	slog.InfoContext(ctx, "Started a preview task for the user", "taskArn", taskARN, "previousTaskArn", previous)
+
+	return &previewTask.Task{ARN: taskARN, UserID: userID, Status: previewTask.STATUS_PROVISIONING, DesiredStatus: previewTask.STATUS_RUNNING}, nil
+}
+
+// ensurePreview starts a preview task for the user after a turn if they have none, e.g. after their first message
+// or once their idle task was stopped, so they can see their app. A failure is only logged, as the turn itself succeeded.
+func (s *Server) ensurePreview(ctx context.Context, userID string) {
+	if s.Previews == nil {
+		return
+	}
+	if _, err := s.startPreview(ctx, userID, false); err != nil {
+		slog.ErrorContext(ctx, "Failed to start a preview task after the turn", "error", err)
+	}
+}
+
+// previewEnv tells a preview task where the user's app code is kept
+func (s *Server) previewEnv(userID string) map[string]string {
+	return map[string]string{
+		PREVIEW_ENV_USER_ID: userID,
+		PREVIEW_ENV_BUCKET:  s.config.Stores.AppBucket,
+		PREVIEW_ENV_PREFIX:  userFolder(userID),
+	}
+}
+
+// lockPreview stops two requests of a user starting preview tasks at once, or a turn or reset saving over a new task.
+// It returns the function unlocking it again.
+func (s *Server) lockPreview(userID string) func() {
+	lock, _ := s.previewLocks.LoadOrStore(userID, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// saveTurn saves the user at the end of a turn, which counts as activity on their preview.
+// Their preview task may have been replaced or stopped while the turn ran, so the stored task is kept rather than the one the turn started with.
+func (s *Server) saveTurn(ctx context.Context, currUserState *userStore.UserState) error {
+	if s.Previews != nil {
+		unlock := s.lockPreview(currUserState.UserID)
+		defer unlock()
+		stored, err := s.Users.GetUser(ctx, currUserState.UserID)
+		if err == nil {
+			currUserState.FargateTaskARN = stored.FargateTaskARN
+		}
+		currUserState.PreviewActiveAt = time.Now()
+	}
+	return s.Users.PutUser(ctx, *currUserState)
+}
@@ -0,0 +1,223 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	previewTask "github.com/stephen1cowley/programming-agent-server/previewTask"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// newPreviewTestServer creates a test server whose preview tasks are recorded in memory
+func newPreviewTestServer(t *testing.T) (*Server, *httptest.Server, *previewTask.MemoryLauncher) {
+	t.Helper()
+	s, ts := newTestServer(t)
+	launcher := previewTask.NewMemoryLauncher()
+	s.Previews = launcher
+	return s, ts, launcher
+}
+
+// requestPreview calls /api/preview as the test user, returning the status code and the preview if there was one
+func requestPreview(t *testing.T, ts *httptest.Server, method string) (int, previewSchema) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+"/api/preview", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("username", TEST_USER)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var preview previewSchema
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, preview
+}
+
+// listTasks returns the tasks of the launcher which have not been stopped
+func listTasks(t *testing.T, launcher *previewTask.MemoryLauncher) []previewTask.Task {
+	t.Helper()
+	tasks, err := launcher.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tasks
+}
+
+func TestPreviewStartedOnPost(t *testing.T) {
+	_, ts, launcher := newPreviewTestServer(t)
+
+	// Asking for the status does not start a task
+	code, preview := requestPreview(t, ts, http.MethodGet)
+	if code != http.StatusOK || preview.Status != PREVIEW_STATUS_NONE {
+		t.Errorf("GET = %d %+v, want status %s", code, preview, PREVIEW_STATUS_NONE)
+	}
+	if tasks := listTasks(t, launcher); len(tasks) != 0 {
+		t.Fatalf("GET started %d tasks, want none", len(tasks))
+	}
+
+	code, started := requestPreview(t, ts, http.MethodPost)
+	if code != http.StatusOK || started.TaskARN == "" {
+		t.Fatalf("POST = %d %+v, want a new task", code, started)
+	}
+
+	code, preview = requestPreview(t, ts, http.MethodGet)
+	if code != http.StatusOK || preview.TaskARN != started.TaskARN || preview.Status != previewTask.STATUS_RUNNING {
+		t.Errorf("GET = %d %+v, want the started task running", code, preview)
+	}
+	if preview.URL != "http://127.0.0.1/" {
+		t.Errorf("url = %q, want the task's public address", preview.URL)
+	}
+
+	// Starting another replaces the first
+	_, restarted := requestPreview(t, ts, http.MethodPost)
+	tasks := listTasks(t, launcher)
+	if len(tasks) != 1 || tasks[0].ARN != restarted.TaskARN {
+		t.Errorf("running tasks = %+v, want only %s", tasks, restarted.TaskARN)
+	}
+}
+
+func TestPreviewStartedByFirstTurn(t *testing.T) {
+	s, ts, launcher := newPreviewTestServer(t)
+
+	for _, text := range []string{"Make it blue", "Add a header"} {
+		if resp := sendMessage(t, ts, text, false); resp.StatusCode != http.StatusOK {
+			t.Fatalf("turn status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	tasks := listTasks(t, launcher)
+	if len(tasks) != 1 {
+		t.Fatalf("turns started %d tasks, want 1", len(tasks))
+	}
+	user := getUser(t, s)
+	if user.FargateTaskARN != tasks[0].ARN || user.PreviewActiveAt.IsZero() {
+		t.Errorf("saved task %q active at %v, want %q with the time of the turn", user.FargateTaskARN, user.PreviewActiveAt, tasks[0].ARN)
+	}
+}
+
+func TestPreviewRateLimited(t *testing.T) {
+	s, ts, _ := newPreviewTestServer(t)
+
+	burst := s.config.Limits.PreviewBurst
+	for i := 0; i < burst; i++ {
+		if code, _ := requestPreview(t, ts, http.MethodGet); code != http.StatusOK {
+			t.Fatalf("GET %d = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if code, _ := requestPreview(t, ts, http.MethodGet); code != http.StatusTooManyRequests {
+		t.Errorf("GET over the burst of %d = %d, want %d", burst, code, http.StatusTooManyRequests)
+	}
+}
+
+func TestReapPreviews(t *testing.T) {
+	s, ts, launcher := newPreviewTestServer(t)
+	ctx := context.Background()
+
+	_, preview := requestPreview(t, ts, http.MethodPost)
+	// A task whose start was never saved with its user
+	orphan, err := launcher.Start(ctx, "bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the grace period and the idle time, nothing is stopped
+	if stopped := s.reapPreviews(ctx, time.Now().Add(PREVIEW_START_GRACE/2)); stopped != 0 {
+		t.Errorf("reapPreviews() stopped %d tasks straight away, want none", stopped)
+	}
+
+	// Once the user has been away for longer than the idle time, both are stopped
+	idle := time.Duration(s.config.ECS.IdleMinutes) * time.Minute
+	if stopped := s.reapPreviews(ctx, time.Now().Add(idle+time.Minute)); stopped != 2 {
+		t.Errorf("reapPreviews() stopped %d tasks, want 2", stopped)
+	}
+	for _, taskARN := range []string{preview.TaskARN, orphan} {
+		if task, _ := launcher.Describe(ctx, taskARN); task.Status != previewTask.STATUS_STOPPED {
+			t.Errorf("task %s is %s, want it stopped", taskARN, task.Status)
+		}
+	}
+
+	// The user is left without a task, which their next message will start
+	if code, got := requestPreview(t, ts, http.MethodGet); code != http.StatusOK || got.Status != PREVIEW_STATUS_NONE {
+		t.Errorf("GET after reaping = %d %+v, want status %s", code, got, PREVIEW_STATUS_NONE)
+	}
+}
+
+func TestReapReason(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.config.ECS.IdleMinutes, s.config.ECS.MaxLifetimeMinutes = 30, 480
+	now := time.Now()
+	task := previewTask.Task{ARN: "task1", UserID: TEST_USER, CreatedAt: now.Add(-time.Hour)}
+	user := func(taskARN string, activeAgo time.Duration) *userStore.UserState {
+		return &userStore.UserState{UserID: TEST_USER, FargateTaskARN: taskARN, PreviewActiveAt: now.Add(-activeAgo)}
+	}
+
+	tests := []struct {
+		name string
+		task previewTask.Task
+		user *userStore.UserState
+		want string
+	}{
+		{"active", task, user("task1", 10*time.Minute), ""},
+		{"idle", task, user("task1", 31*time.Minute), "Idle for longer than 30 minutes"},
+		{"new task of an idle user", previewTask.Task{ARN: "task1", CreatedAt: now.Add(-time.Minute)}, user("task1", 2*time.Hour), ""},
+		{"too old", previewTask.Task{ARN: "task1", CreatedAt: now.Add(-9 * time.Hour)}, user("task1", time.Minute), "Ran for longer than 480 minutes"},
+		{"replaced", task, user("task2", time.Minute), "No longer the user's preview task"},
+		{"user deleted", task, nil, "No longer the user's preview task"},
+		{"being saved", previewTask.Task{ARN: "task2", CreatedAt: now.Add(-time.Minute)}, user("task1", time.Minute), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.reapReason(test.task, test.user, now); got != test.want {
+				t.Errorf("reapReason() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResetKeepsPreview(t *testing.T) {
+	s, ts, _ := newPreviewTestServer(t)
+
+	code, started := requestPreview(t, ts, http.MethodPost)
+	if code != http.StatusOK || started.TaskARN == "" {
+		t.Fatalf("POST = %d %+v, want a new task", code, started)
+	}
+
+	// A reset waits for a preview being started, so it cannot save over the new task
+	unlock := s.lockPreview(TEST_USER)
+	done := make(chan int)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/reset", nil)
+		req.Header.Set("username", TEST_USER)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	select {
+	case code := <-done:
+		t.Fatalf("reset finished with %d while the preview was locked", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("reset status = %d, want %d", code, http.StatusOK)
+	}
+
+	if user := getUser(t, s); user.FargateTaskARN != started.TaskARN {
+		t.Errorf("task after reset = %q, want %q", user.FargateTaskARN, started.TaskARN)
+	}
+}
@@ -0,0 +1,100 @@
+package apiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// llmHTTPClient sends model calls with the ID and trace context of the API request that made them
+var llmHTTPClient = &http.Client{Transport: otelhttp.NewTransport(&appLog.Transport{})}
+
+// newProvider creates the chat Provider selected by llm.provider.
+// OpenAI uses llm.openaiApiKey if set, and otherwise the key in the AWS Secrets Manager secret llm.secretId.
+// An OpenAI-compatible server is found at llm.baseUrl, authenticated with the optional llm.apiKey.
+// The scripted provider replies from the script file at llm.script, for deterministic tests.
+func newProvider(ctx context.Context, config *appConfig.Config) (llm.Provider, error) {
+	switch config.LLM.Provider {
+	case appConfig.LLM_PROVIDER_OPENAI:
+		apiKey := config.LLM.OpenAIAPIKey
+		if apiKey == "" {
+			secretData, err := getSecret(ctx, config)
+			if err != nil {
+				return nil, err
+			}
+			apiKey = secretData.OpenAIAPI
+		}
+		return llm.NewOpenAI(apiKey, llmHTTPClient), nil
+	case appConfig.LLM_PROVIDER_OPENAI_COMPATIBLE:
+		return llm.NewOpenAICompatible(config.LLM.BaseURL, config.LLM.APIKey, llmHTTPClient), nil
+	case appConfig.LLM_PROVIDER_SCRIPTED:
+		return llm.LoadScriptedProvider(config.LLM.Script)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", config.LLM.Provider)
+	}
+}
+
+// getContextWindow returns llm.contextWindow, the tokens the model can handle in one request,
+// defaulting to the known size for the model
+func getContextWindow(settings appConfig.LLMConfig, model string) int {
+	if settings.ContextWindow > 0 {
+		return settings.ContextWindow
+	}
+	return llm.ContextWindow(model)
+}
+
+// getPrice returns the price of the model's tokens, in US dollars per million.
+// llm.pricePrompt and llm.priceCompletion override the known prices, and must be set for other models for their cost to be counted.
+func getPrice(settings appConfig.LLMConfig, model string) llm.Price {
+	price, known := llm.ModelPrice(model)
+	if settings.PricePrompt != nil {
+		price.PromptPerMillion, known = *settings.PricePrompt, true
+	}
+	if settings.PriceCompletion != nil {
+		price.CompletionPerMillion, known = *settings.PriceCompletion, true
+	}
+	if !known {
+		slog.Warn("The price of the model is unknown, so its cost will be counted as zero", "model", model)
+	}
+	return price
+}
+
+// getSecret retrieves the OpenAI API key from AWS Secrets Manager
+func getSecret(ctx context.Context, config *appConfig.Config) (secretSchema, error) {
+	var secretData secretSchema
+
+	cfg, err := loadAWSConfig(ctx, config.AWS.Region)
+	if err != nil {
+		return secretData, err
+	}
+
+	// Create a Secrets Manager client
+	svc := secretsmanager.NewFromConfig(cfg)
+
+	// Create the input for the GetSecretValue API call
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(config.LLM.SecretID),
+	}
+
+	// Retrieve the secret value
+	result, err := svc.GetSecretValue(ctx, input)
+	if err != nil {
+		return secretData, fmt.Errorf("failed to retrieve secret, %w", err)
+	}
+
+	err = json.Unmarshal([]byte(*result.SecretString), &secretData)
+	if err != nil {
+		return secretData, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return secretData, nil
+}
@@ -0,0 +1,114 @@
+package apiAgent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	previewTask "github.com/stephen1cowley/programming-agent-server/previewTask"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// PREVIEW_REAP_INTERVAL is how often the preview tasks are checked for any to stop
+const PREVIEW_REAP_INTERVAL = 5 * time.Minute
+
+// PREVIEW_START_GRACE is how long a new task may go without being saved with its user before it is taken to be left over
+// from a start which failed, rather than one whose user is still being saved
+const PREVIEW_START_GRACE = 5 * time.Minute
+
+// runPreviewReaper stops the preview tasks which are idle, have run for too long, or are no longer any user's,
+// every PREVIEW_REAP_INTERVAL until the context is done. Each server checks every task, as stopping a task twice is harmless.
+func (s *Server) runPreviewReaper(ctx context.Context) {
+	ticker := time.NewTicker(PREVIEW_REAP_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.reapPreviews(ctx, now)
+		}
+	}
+}
+
+// reapPreviews stops each preview task reapReason gives a reason to stop, returning how many were stopped.
+// A user whose task is stopped is left with none, so their next message starts a new one.
+func (s *Server) reapPreviews(ctx context.Context, now time.Time) int {
+	tasks, err := s.Previews.List(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list the preview tasks", "error", err)
+		return 0
+	}
+
+	stopped := 0
+	for _, task := range tasks {
+		user, err := s.Users.GetUser(ctx, task.UserID)
+		if errors.Is(err, userStore.ErrUserNotFound) {
+			user = nil
+		} else if err != nil {
+			slog.WarnContext(ctx, "Failed to get the user of a preview task", "taskArn", task.ARN, "error", err)
+			continue
+		}
+
+		reason := s.reapReason(task, user, now)
+		if reason == "" {
+			continue
+		}
+		if err := s.Previews.Stop(ctx, task.ARN, reason); err != nil {
+			slog.ErrorContext(ctx, "Failed to stop the preview task", "taskArn", task.ARN, "error", err)
+			continue
+		}
+		stopped++
+		slog.InfoContext(ctx, "Stopped a preview task", "taskArn", task.ARN, "user", task.UserID, "reason", reason)
+
+		if user != nil && user.FargateTaskARN == task.ARN {
+			s.forgetPreview(ctx, task.UserID, task.ARN)
+		}
+	}
+	return stopped
+}
+
+// reapReason returns why the task should be stopped, or "" if it should keep running.
+// The user is nil if the task's user does not exist.
+func (s *Server) reapReason(task previewTask.Task, user *userStore.UserState, now time.Time) string {
+	settings := s.config.ECS
+	age := now.Sub(task.CreatedAt)
+
+	maxLifetime := time.Duration(settings.MaxLifetimeMinutes) * time.Minute
+	if maxLifetime > 0 && age > maxLifetime {
+		return fmt.Sprintf("Ran for longer than %d minutes", settings.MaxLifetimeMinutes)
+	}
+	// A task replaced by a new one which could not be stopped, or started for a user who could not be saved
+	if (user == nil || user.FargateTaskARN != task.ARN) && age > PREVIEW_START_GRACE {
+		return "No longer the user's preview task"
+	}
+
+	idle := time.Duration(settings.IdleMinutes) * time.Minute
+	if idle > 0 && user != nil {
+		lastActive := user.PreviewActiveAt
+		if task.CreatedAt.After(lastActive) {
+			lastActive = task.CreatedAt
+		}
+		if now.Sub(lastActive) > idle {
+			return fmt.Sprintf("Idle for longer than %d minutes", settings.IdleMinutes)
+		}
+	}
+	return ""
+}
+
+// forgetPreview removes the stopped task from its user, unless they have since been given another
+func (s *Server) forgetPreview(ctx context.Context, userID string, taskARN string) {
+	unlock := s.lockPreview(userID)
+	defer unlock()
+
+	currUserState, err := s.Users.GetUser(ctx, userID)
+	if err != nil || currUserState.FargateTaskARN != taskARN {
+		return
+	}
+	currUserState.FargateTaskARN = ""
+	if err := s.Users.PutUser(ctx, *currUserState); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove the stopped preview task from its user", "taskArn", taskARN, "error", err)
+	}
+}
@@ -0,0 +1,213 @@
+package apiAgent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+	auth "github.com/stephen1cowley/programming-agent-server/auth"
+	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+	rateLimit "github.com/stephen1cowley/programming-agent-server/rateLimit"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Server is the Programming Agent API. It holds everything its handlers share:
+// the stores, the authentication and rate limits, and the agent, which is replaced as a whole on restart.
+// Several servers can run in one process, e.g. with fake stores in tests.
+type Server struct {
+	config *appConfig.Config
+	Stores
+
+	// Verifies the bearer tokens of API requests, or nil if auth.disabled is set
+	verifier *auth.Verifier
+
+	// Limits of the messages sent by each user and IP address, of the preview requests of each user,
+	// and of the model calls running at once
+	userLimiter    *rateLimit.KeyedLimiter
+	ipLimiter      *rateLimit.KeyedLimiter
+	previewLimiter *rateLimit.KeyedLimiter
+	modelSlots     *rateLimit.FairSemaphore
+
+	agent atomic.Pointer[agent]
+	// The last failed reload, or nil if the last reload succeeded
+	reloadFailure atomic.Pointer[reloadFailure]
+
+	// The last results of the readiness checks
+	health healthCache
+
+	// Locks of each user's preview task, by user ID
+	previewLocks sync.Map
+}
+
+// reloadFailure is a reload which failed, leaving the previous agent in use.
+type reloadFailure struct {
+	err error
+	at  time.Time
+}
+
+// agent is the model the server chats with and the tools it may call.
+// It is never changed once created, so a turn can keep using the agent it started with while a restart replaces it.
+type agent struct {
+	provider      llm.Provider
+	model         string
+	contextWindow int
+	price         llm.Price
+	monthlyBudget float64
+	tools         *funcTools.Registry
+	loadedAt      time.Time
+}
+
+// NewServer creates a server using the stores, with authentication, limits and the agent set up from the config
+func NewServer(ctx context.Context, config *appConfig.Config, stores Stores) (*Server, error) {
+	s := &Server{config: config, Stores: stores}
+
+	var err error
+	s.verifier, err = newVerifier(config.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up authentication, %w", err)
+	}
+
+	limits := config.Limits
+	s.userLimiter = rateLimit.NewKeyedLimiter("user", float64(limits.UserPerMinute), limits.UserBurst)
+	s.ipLimiter = rateLimit.NewKeyedLimiter("ip", float64(limits.IPPerMinute), limits.IPBurst)
+	s.previewLimiter = rateLimit.NewKeyedLimiter("preview", float64(limits.PreviewPerMinute), limits.PreviewBurst)
+	s.modelSlots = rateLimit.NewFairSemaphore("model", limits.MaxConcurrent, limits.MaxQueued, seconds(limits.QueueTimeoutSeconds))
+
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload creates a fresh agent, e.g. to fetch the API key again, and swaps it in for new turns.
+// If it fails the current agent is kept.
+func (s *Server) Reload(ctx context.Context) error {
+	newAgent, err := newAgent(ctx, s.config)
+	if err != nil {
+		s.reloadFailure.Store(&reloadFailure{err: err, at: time.Now()})
+		return err
+	}
+	s.agent.Store(newAgent)
+	s.reloadFailure.Store(nil)
+	return nil
+}
+
+// newAgent creates the provider and tool registry, and looks up the model's context window and price
+func newAgent(ctx context.Context, config *appConfig.Config) (*agent, error) {
+	provider, err := newProvider(ctx, config)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create LLM provider", "error", err)
+		return nil, err
+	}
+
+	tools, err := funcTools.NewRegistry(funcTools.Tools...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to register tools", "error", err)
+		return nil, err
+	}
+
+	model := config.LLM.Model
+	return &agent{
+		provider:      provider,
+		model:         model,
+		contextWindow: getContextWindow(config.LLM, model),
+		price:         getPrice(config.LLM, model),
+		monthlyBudget: config.LLM.MonthlyBudget,
+		tools:         tools,
+		loadedAt:      time.Now(),
+	}, nil
+}
+
+// Serve listens on server.addr until the context is done, e.g. on SIGTERM.
+// It then stops accepting connections, and waits up to server.shutdownTimeoutSeconds for requests,
+// including chat turns, to finish before returning.
+// Meanwhile idle and old preview tasks are stopped, if ecs.idleMinutes or ecs.maxLifetimeMinutes is set.
+func (s *Server) Serve(ctx context.Context) error {
+	if s.Previews != nil && (s.config.ECS.IdleMinutes > 0 || s.config.ECS.MaxLifetimeMinutes > 0) {
+		go s.runPreviewReaper(ctx)
+	}
+
+	settings := s.config.Server
+	httpServer := &http.Server{
+		Addr:              settings.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: seconds(settings.ReadHeaderTimeoutSeconds),
+		ReadTimeout:       seconds(settings.ReadTimeoutSeconds),
+		WriteTimeout:      seconds(settings.WriteTimeoutSeconds),
+		IdleTimeout:       seconds(settings.IdleTimeoutSeconds),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server listening", "addr", settings.Addr, "environment", s.config.Environment)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := seconds(settings.ShutdownTimeoutSeconds)
+	slog.Info("Shutting down, waiting for requests to finish", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("requests were still running after %s: %w", timeout, err)
+	}
+	slog.Info("All requests finished")
+	return nil
+}
+
+// seconds converts a number of seconds from the config to a duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// Handler routes the API endpoints to the server's handlers
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	// Requests to each route are counted and timed
+	handle := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, appMetrics.InstrumentRoute(pattern, handler))
+	}
+	handle("/api/test/", http.HandlerFunc(apiTestHandler))
+	handle("/healthz", http.HandlerFunc(healthzHandler))
+	handle("/readyz", http.HandlerFunc(s.readyzHandler))
+	handle("/api/message", s.corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(s.ipLimiter, s.userLimiter, http.HandlerFunc(s.apiMessageHandler)))))
+	handle("/api/restart", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiRestartHandler))))
+	handle("/api/upload", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiUploadHandler))))
+	handle("/api/imdel", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiImdelHandler))))
+	handle("/api/reset", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiResetHandler))))
+	handle("/api/history", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiHistoryHandler))))
+	handle("/api/undo", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiUndoHandler))))
+	handle("/api/redo", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiRedoHandler))))
+	handle("/api/usage", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.apiUsageHandler))))
+	handle("/api/preview", s.corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(nil, s.previewLimiter, http.HandlerFunc(s.apiPreviewHandler)))))
+	mux.Handle("/metrics", appMetrics.Handler())
+
+	// Local blob stores are served by this server in place of the public buckets
+	if handler, ok := s.Images.(http.Handler); ok {
+		handle(IMAGES_PATH, http.StripPrefix(IMAGES_PATH, handler))
+	}
+	if handler, ok := s.AppFiles.(http.Handler); ok {
+		handle(APP_FILES_PATH, http.StripPrefix(APP_FILES_PATH, handler))
+	}
+	// Each request's span is named after its route, e.g. "POST /api/message", so the paths of blobs do not each get their own
+	// Health checks are only logged at debug level, unless they fail
+	logged := appLog.Middleware(mux, "/api/test/", "/healthz", "/readyz", "/metrics")
+	return otelhttp.NewHandler(logged, "http", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return r.Method + " " + pattern
+	}))
+}
@@ -0,0 +1,88 @@
+package apiAgent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	buildCheck "github.com/stephen1cowley/programming-agent-server/buildCheck"
+)
+
+// Names of the Server-Sent Events of a streamed chat turn
+const (
+	EVENT_TOKEN  = "token"  // a piece of the assistant's reply, as tokenEvent
+	EVENT_FILE   = "file"   // progress updating a file, as fileEvent
+	EVENT_REPAIR = "repair" // the app does not build, so the model is fixing it, as repairEvent
+	EVENT_SAVED  = "saved"  // the turn has been persisted
+	EVENT_DONE   = "done"   // the final reply, as msgSchema
+	EVENT_ERROR  = "error"  // the turn failed, as errorEvent
+)
+
+// tokenEvent carries a piece of the assistant's reply as it is generated.
+type tokenEvent struct {
+	Text string `json:"text"`
+}
+
+// fileEvent reports progress updating one of the app's files, with Status one of the funcTools.FILE_* statuses.
+// Diagnostics are the compile errors which caused a file to fail.
+type fileEvent struct {
+	FileName    string                  `json:"fileName"`
+	Status      string                  `json:"status"`
+	Diagnostics []buildCheck.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// repairEvent reports the start of a round of fixing the errors which stop the app building.
+type repairEvent struct {
+	Round       int                     `json:"round"`
+	Diagnostics []buildCheck.Diagnostic `json:"diagnostics"`
+}
+
+// errorEvent reports a failure part-way through a streamed response.
+type errorEvent struct {
+	Error string `json:"error"`
+}
+
+// sseWriter writes Server-Sent Events, flushing each one to the client immediately.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// wantsStream reports whether the client asked for a Server-Sent Events response,
+// either with an "Accept: text/event-stream" header or a "stream=true" query parameter.
+func wantsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.URL.Query().Get("stream") == "true"
+}
+
+// newSSEWriter sends the event stream headers, after which only events may be written
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response writer does not support flushing")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+// send writes an event with its data encoded as JSON
+func (s *sseWriter) send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,156 @@
+package apiAgent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/middleware"
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	awsHandlers "github.com/stephen1cowley/programming-agent-server/awsHandlers"
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
+	previewTask "github.com/stephen1cowley/programming-agent-server/previewTask"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// Paths the local blob stores are served from
+const (
+	IMAGES_PATH    = "/blobs/images/"
+	APP_FILES_PATH = "/blobs/app/"
+)
+
+// Stores are where the server keeps users' state and files, and runs the previews of their apps.
+// Images holds the images uploaded by users, and AppFiles the code of their apps. Both are keyed by userFolder.
+// Previews is nil if previews are not run by this server.
+type Stores struct {
+	Users    userStore.UserStore
+	Images   blobStore.BlobStore
+	AppFiles blobStore.BlobStore
+	Previews previewTask.Launcher
+}
+
+// NewStores creates the stores selected by the config
+func NewStores(ctx context.Context, conf *appConfig.Config) (Stores, error) {
+	users, err := newUserStore(ctx, conf)
+	if err != nil {
+		return Stores{}, fmt.Errorf("error creating the user store, %w", err)
+	}
+	images, appFiles, err := newBlobStores(ctx, conf)
+	if err != nil {
+		return Stores{}, fmt.Errorf("error creating the blob stores, %w", err)
+	}
+	previews, err := newPreviewLauncher(ctx, conf)
+	if err != nil {
+		return Stores{}, fmt.Errorf("error creating the preview launcher, %w", err)
+	}
+	return Stores{Users: users, Images: images, AppFiles: appFiles, Previews: previews}, nil
+}
+
+// newUserStore creates the UserStore selected by stores.userStore.
+// The file store keeps its data in stores.userStoreDir.
+func newUserStore(ctx context.Context, conf *appConfig.Config) (userStore.UserStore, error) {
+	switch conf.Stores.UserStore {
+	case appConfig.USER_STORE_DYNAMO:
+		cfg, err := loadAWSConfig(ctx, conf.AWS.Region)
+		if err != nil {
+			return nil, err
+		}
+		return awsHandlers.NewDynamoUserStore(cfg, conf.Stores.DynamoTable), nil
+	case appConfig.USER_STORE_MEMORY:
+		return userStore.NewMemoryStore(), nil
+	case appConfig.USER_STORE_FILE:
+		return userStore.NewFileStore(conf.Stores.UserStoreDir)
+	default:
+		return nil, fmt.Errorf("unknown user store %q", conf.Stores.UserStore)
+	}
+}
+
+// newBlobStores creates the image and app-code BlobStores selected by stores.blobStore.
+// The local stores keep their data in stores.blobStoreDir and are served by this server at server.publicUrl.
+func newBlobStores(ctx context.Context, conf *appConfig.Config) (blobStore.BlobStore, blobStore.BlobStore, error) {
+	switch conf.Stores.BlobStore {
+	case appConfig.BLOB_STORE_S3:
+		cfg, err := loadAWSConfig(ctx, conf.AWS.Region)
+		if err != nil {
+			return nil, nil, err
+		}
+		return awsHandlers.NewS3BlobStore(cfg, conf.Stores.ImagesBucket), awsHandlers.NewS3BlobStore(cfg, conf.Stores.AppBucket), nil
+	case appConfig.BLOB_STORE_LOCAL:
+		dir := conf.Stores.BlobStoreDir
+		publicURL := strings.TrimSuffix(conf.Server.PublicURL, "/")
+		localImages, err := blobStore.NewLocalStore(filepath.Join(dir, "images"), publicURL+IMAGES_PATH)
+		if err != nil {
+			return nil, nil, err
+		}
+		localAppFiles, err := blobStore.NewLocalStore(filepath.Join(dir, "app"), publicURL+APP_FILES_PATH)
+		if err != nil {
+			return nil, nil, err
+		}
+		return localImages, localAppFiles, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown blob store %q", conf.Stores.BlobStore)
+	}
+}
+
+// newPreviewLauncher creates the Launcher selected by ecs.launcher, or nil for none
+func newPreviewLauncher(ctx context.Context, conf *appConfig.Config) (previewTask.Launcher, error) {
+	switch conf.ECS.Launcher {
+	case appConfig.PREVIEW_LAUNCHER_ECS:
+		cfg, err := loadAWSConfig(ctx, conf.AWS.Region)
+		if err != nil {
+			return nil, err
+		}
+		return awsHandlers.NewECSLauncher(cfg, PreviewDeployment(conf)), nil
+	case appConfig.PREVIEW_LAUNCHER_MEMORY:
+		return previewTask.NewMemoryLauncher(), nil
+	case appConfig.PREVIEW_LAUNCHER_NONE:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown preview launcher %q", conf.ECS.Launcher)
+	}
+}
+
+// PreviewDeployment is where the config builds the preview image and runs the users' preview tasks
+func PreviewDeployment(conf *appConfig.Config) awsHandlers.Deployment {
+	return awsHandlers.Deployment{
+		AppDir:           conf.ECS.AppDir,
+		ImageName:        conf.ECS.Repository,
+		Registry:         conf.ECRRegistry(),
+		Image:            conf.ECRImage(),
+		Cluster:          conf.ECS.Cluster,
+		Subnets:          conf.ECS.Subnets,
+		SecurityGroups:   conf.ECS.SecurityGroups,
+		ExecutionRoleARN: conf.ExecutionRoleARN(),
+	}
+}
+
+// loadAWSConfig loads the shared AWS configuration (~/.aws/config) for the configured region.
+// Every call made with it is timed, and logged at debug level.
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region),
+		config.WithAPIOptions([]func(*middleware.Stack) error{awsHandlers.InstrumentAPICalls}))
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	return cfg, nil
+}
+
+// userFolder is the prefix of every blob belonging to the user, in both the image and app-code stores
+func userFolder(userID string) string {
+	return "uploads/" + userID + "/"
+}
+
+// loadUser gets the user's state from the store, starting a fresh state if the user has none yet.
+func (s *Server) loadUser(ctx context.Context, userID string) (*userStore.UserState, error) {
+	user, err := s.Users.GetUser(ctx, userID)
+	if errors.Is(err, userStore.ErrUserNotFound) {
+		slog.InfoContext(ctx, "Creating fresh state for the user")
+		return &userStore.UserState{UserID: userID}, nil
+	}
+	return user, err
+}
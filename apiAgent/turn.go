@@ -0,0 +1,490 @@
+package apiAgent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	buildCheck "github.com/stephen1cowley/programming-agent-server/buildCheck"
+	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// eventFunc receives the events of a chat turn as it runs, so they can be streamed to the client.
+type eventFunc func(event string, data any)
+
+// turn is a chat turn in progress.
+type turn struct {
+	server *Server
+	agent  *agent
+	state  *userStore.UserState
+	emit   eventFunc
+	// failed is set once any tool call fails
+	failed bool
+	// usage is the tokens of every model call so far
+	usage llm.Usage
+	// rejected holds the compile errors of each file the model failed to save, until it saves it successfully
+	rejected map[string][]buildCheck.Diagnostic
+	// snapshots recorded by the turn, whose files are saved with the turn
+	snapshots []funcTools.Snapshot
+	// dropped are the IDs of the snapshots the turn dropped from the history, whose files are deleted once it is saved
+	dropped []int
+}
+
+// errTurnNotSaved is returned by runTurn when the turn finished but could not be saved
+var errTurnNotSaved = errors.New("the turn could not be saved")
+
+// turnResult is the outcome of a chat turn.
+type turnResult struct {
+	Text         string
+	Usage        userStore.TurnUsage
+	Diagnostics  []buildCheck.Diagnostic
+	BuildOK      bool // whether the app builds at the end of the turn
+	RepairRounds int  // rounds spent fixing build errors
+}
+
+// reply returns the message to send the user
+func (r turnResult) reply() msgSchema {
+	return msgSchema{
+		Role:         "ai",
+		Text:         r.Text,
+		Diagnostics:  r.Diagnostics,
+		BuildOK:      r.BuildOK,
+		RepairRounds: r.RepairRounds,
+		Usage:        &r.Usage,
+	}
+}
+
+// codeBlocks matches everything between triple backticks
+var codeBlocks = regexp.MustCompile("```[^```]+```")
+
+// Label of the snapshot of each user's files before their first turn
+const FIRST_SNAPSHOT_LABEL = "Start"
+
+// runTurn sends the user's text to the model and runs the agent loop:
+// each tool call the model makes is executed, and its result sent back to the model,
+// until the model replies without calling any tools or the step limit is reached.
+// If the turn changed the app and it no longer builds, the build errors are sent back to the model
+// for up to agent.repairMaxAttempts more rounds of the agent loop.
+// The whole exchange is appended to the user's messages, the resulting files are snapshotted,
+// the user is saved, and the final reply to show the user is returned.
+// If emit is not nil the replies are streamed, and emit receives each token and file update.
+// The tokens used and their cost are recorded against the user.
+// Files which do not compile are not saved, and their compile errors are returned with the reply.
+// A turn which fails part way, e.g. because a model call failed or was cancelled, or cannot be saved, leaves the user as they were:
+// the files its tools wrote are restored in the app-code store, and the state is returned to what it was before.
+// The model calls it made are still recorded against the user, as they have been paid for.
+// Once a turn is saved, a user without a preview task has one started.
+func (s *Server) runTurn(ctx context.Context, currUserState *userStore.UserState, text string, emit eventFunc) (turnResult, error) {
+	original := currUserState.Clone()
+	t := &turn{
+		server:   s,
+		agent:    s.agent.Load(),
+		state:    currUserState,
+		emit:     emit,
+		rejected: make(map[string][]buildCheck.Diagnostic),
+	}
+
+	ctx, span := appTrace.Start(ctx, "chat turn", attribute.String("llm.model", t.agent.model))
+	result, err := t.run(ctx, text)
+	if err == nil {
+		err = t.save(ctx)
+	}
+	if err != nil {
+		s.rollbackTurn(ctx, currUserState, original)
+		t.saveUsage(ctx)
+	} else {
+		s.ensurePreview(ctx, currUserState.UserID)
+	}
+	span.SetAttributes(attribute.Bool("build.ok", result.BuildOK), attribute.Int("build.repair_rounds", result.RepairRounds))
+	appTrace.End(span, err)
+	return result, err
+}
+
+// save saves the files of the turn's snapshots and then the user, and deletes the files of the snapshots it dropped.
+// The finished turn is saved even if the client has just disconnected.
+func (t *turn) save(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	userID := t.state.UserID
+	for _, snap := range t.snapshots {
+		if err := t.server.putSnapshot(ctx, userID, snap); err != nil {
+			return fmt.Errorf("%w: %w", errTurnNotSaved, err)
+		}
+	}
+	if err := t.server.saveTurn(ctx, t.state); err != nil {
+		return fmt.Errorf("%w: %w", errTurnNotSaved, err)
+	}
+	t.server.deleteSnapshots(ctx, userID, t.dropped)
+	return nil
+}
+
+// saveUsage records the tokens of a failed turn's model calls against the user, who has been rolled back, and saves them.
+// The usage is saved even if the turn was cancelled.
+func (t *turn) saveUsage(ctx context.Context) {
+	if t.usage.TotalTokens == 0 {
+		return
+	}
+	t.state.RecordUsage(userStore.NewTurnUsage(time.Now(), t.agent.model, t.usage, t.agent.price))
+	if err := t.server.saveTurn(context.WithoutCancel(ctx), t.state); err != nil {
+		slog.ErrorContext(ctx, "Failed to save the usage of the failed turn", "error", err)
+	}
+}
+
+// recordSnapshot adds the user's current files to their history, unless they are unchanged since the current snapshot
+func (t *turn) recordSnapshot(label string) {
+	snap, dropped, recorded := t.state.RecordSnapshot(label)
+	if recorded {
+		t.snapshots = append(t.snapshots, snap)
+	}
+	t.dropped = append(t.dropped, dropped...)
+}
+
+// rollbackTurn undoes a turn which could not be finished, restoring the files it wrote and then the state from before it.
+// Files which did not exist before the turn are deleted, and the files are restored even if the turn was cancelled.
+func (s *Server) rollbackTurn(ctx context.Context, currUserState *userStore.UserState, original userStore.UserState) {
+	err := s.newProject(currUserState).Restore(context.WithoutCancel(ctx), original.DirectoryState.TakeSnapshot(0, ""))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to restore the app's files after the turn failed", "error", err)
+	}
+	*currUserState = original
+}
+
+// run runs the turn, as described by runTurn
+func (t *turn) run(ctx context.Context, text string) (turnResult, error) {
+	s, currUserState := t.server, t.state
+
+	// Users' first turns need a snapshot to undo back to
+	if len(currUserState.Snapshots) == 0 {
+		t.recordSnapshot(FIRST_SNAPSHOT_LABEL)
+	}
+	before := currUserState.DirectoryState.TakeSnapshot(0, "")
+
+	currUserState.Messages = append(currUserState.Messages, llm.Message{
+		Role:    llm.RoleUser,
+		Content: text,
+	})
+
+	content, err := t.runAgent(ctx)
+	if err != nil {
+		return turnResult{}, err
+	}
+
+	// Only fix the app if this turn broke it, rather than spending the user's turn on older problems
+	result := turnResult{}
+	buildErr := buildCheck.CheckProject(currUserState.DirectoryState.Files())
+	maxRepairs := s.config.Agent.RepairMaxAttempts
+	for buildErr != nil && result.RepairRounds < maxRepairs && !before.SameFiles(currUserState.DirectoryState) {
+		result.RepairRounds++
+		slog.InfoContext(ctx, "Repairing the build", "round", result.RepairRounds)
+		if t.emit != nil {
+			t.emit(EVENT_REPAIR, repairEvent{Round: result.RepairRounds, Diagnostics: buildDiagnostics(buildErr)})
+		}
+
+		currUserState.Messages = append(currUserState.Messages, llm.Message{
+			Role: llm.RoleSystem,
+			Content: "Your changes were saved, but " + buildErr.Error() + `
+				Fix these errors with the tools. Then reply to the user as you would have done, without mentioning the errors.`,
+		})
+		repaired, err := t.runAgent(ctx)
+		if err != nil {
+			return turnResult{}, err
+		}
+		if repaired != "" {
+			content = repaired
+		}
+		buildErr = buildCheck.CheckProject(currUserState.DirectoryState.Files())
+	}
+	result.BuildOK = buildErr == nil
+	// The repair prompts were only for this turn, and are not kept in the conversation
+	currUserState.Messages = withoutSystemMessages(currUserState.Messages)
+
+	// Fall back to a response describing the outcome if the model never replied in words
+	if content == "" {
+		if t.failed {
+			content = "Sorry, I wasn't able to make all of those changes."
+		} else {
+			content = "Done!"
+		}
+	}
+
+	// Replace all occurrences of stuff between ```...```
+	result.Text = codeBlocks.ReplaceAllString(content, "")
+
+	t.compactHistory(ctx)
+	currUserState.Messages = omitToolResults(currUserState.Messages, MAX_HISTORY_BYTES)
+	t.recordSnapshot(text)
+
+	result.Usage = userStore.NewTurnUsage(time.Now(), t.agent.model, t.usage, t.agent.price)
+	currUserState.RecordUsage(result.Usage)
+
+	result.Diagnostics = append(t.diagnostics(), buildDiagnostics(buildErr)...)
+	return result, nil
+}
+
+// withoutSystemMessages removes the system messages, i.e. the repair prompts, from a conversation
+func withoutSystemMessages(messages []llm.Message) []llm.Message {
+	kept := messages[:0]
+	for _, message := range messages {
+		if message.Role != llm.RoleSystem {
+			kept = append(kept, message)
+		}
+	}
+	return kept
+}
+
+// runAgent calls the model and executes its tool calls, until it replies without calling any tools or runs out of steps.
+// It returns the model's last reply in words, if any.
+func (t *turn) runAgent(ctx context.Context) (string, error) {
+	maxSteps := t.server.config.Agent.MaxSteps
+	var content string
+	for step := 0; ; step++ {
+		// Once out of steps, the model must reply without making any more changes
+		tools := t.agent.tools.Definitions()
+		if step == maxSteps {
+			tools = nil
+		}
+
+		// A turn which cannot fit in the context window even on its own ends with what it has done so far
+		if !t.fitsContext(ctx, tools) {
+			slog.WarnContext(ctx, "The turn no longer fits in the model's context window", "step", step)
+			t.failed = true
+			return content, nil
+		}
+
+		resp, err := t.chat(ctx, tools)
+		if err != nil {
+			return "", err
+		}
+
+		reply := resp.Message
+		reply.Role = llm.RoleAssistant
+		if step == maxSteps {
+			reply.ToolCalls = nil
+		}
+		t.state.Messages = append(t.state.Messages, reply)
+		if reply.Content != "" {
+			content = reply.Content
+		}
+		slog.DebugContext(ctx, "Model replied", appLog.Content("content", reply.Content), "toolCalls", len(reply.ToolCalls))
+
+		if len(reply.ToolCalls) == 0 {
+			return content, nil
+		}
+
+		for _, call := range reply.ToolCalls {
+			result, ok := t.executeToolCall(ctx, call)
+			t.failed = t.failed || !ok
+			t.state.Messages = append(t.state.Messages, llm.Message{
+				Role:       llm.RoleTool,
+				Content:    result,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// buildDiagnostics returns the diagnostics of a *buildCheck.BuildError, or nil for any other error
+func buildDiagnostics(err error) []buildCheck.Diagnostic {
+	var buildErr *buildCheck.BuildError
+	if errors.As(err, &buildErr) {
+		return buildErr.Diagnostics
+	}
+	return nil
+}
+
+// diagnostics returns the compile errors of every file the model failed to save, sorted by file
+func (t *turn) diagnostics() []buildCheck.Diagnostic {
+	var fileNames []string
+	for fileName := range t.rejected {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var diagnostics []buildCheck.Diagnostic
+	for _, fileName := range fileNames {
+		diagnostics = append(diagnostics, t.rejected[fileName]...)
+	}
+	return diagnostics
+}
+
+// chat makes a single model call with the user's conversation so far, sandwiched between the system messages
+func (t *turn) chat(ctx context.Context, tools []llm.Tool) (*llm.Response, error) {
+	startSysMsg, endSysMsg := t.server.systemMessages(t.state)
+
+	// Start and end system message with user/machine communication sandwiched inbetween
+	messagesWithSys := append(append([]llm.Message{startSysMsg}, t.state.Messages...), endSysMsg)
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.DebugContext(ctx, "Prompt", appLog.Content("messages", fmt.Sprint(messagesWithSys)))
+	}
+
+	req := llm.Request{
+		Model:       t.agent.model,
+		Messages:    messagesWithSys,
+		Tools:       tools,
+		Temperature: 0.8,
+	}
+
+	// Wait for a turn to call the model, as only so many calls may run at once
+	if err := t.acquireModelSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer t.server.modelSlots.Release()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	ctx, span := appTrace.Start(ctx, "llm chat", attribute.String("llm.model", req.Model),
+		attribute.Int("llm.messages", len(req.Messages)), attribute.Int("llm.tools", len(req.Tools)))
+	start := time.Now()
+	var resp *llm.Response
+	var err error
+	var streamed strings.Builder
+	if t.emit == nil {
+		resp, err = t.agent.provider.Chat(ctx, req)
+	} else {
+		resp, err = t.agent.provider.ChatStream(ctx, req, func(token string) {
+			streamed.WriteString(token)
+			t.emit(EVENT_TOKEN, tokenEvent{Text: token})
+		})
+	}
+	if err != nil {
+		// A reply which failed part way through has still been paid for
+		if streamed.Len() != 0 {
+			t.countUsage(req, &llm.Response{Message: llm.Message{Content: streamed.String()}})
+		}
+		appMetrics.ObserveModelCall(req.Model, time.Since(start), 0, 0, err)
+		appTrace.End(span, err)
+		return nil, fmt.Errorf("ChatCompletion error: %w", err)
+	}
+	usage := t.countUsage(req, resp)
+	appMetrics.ObserveModelCall(req.Model, time.Since(start), usage.PromptTokens, usage.CompletionTokens, nil)
+	span.SetAttributes(attribute.Int("llm.prompt_tokens", usage.PromptTokens), attribute.Int("llm.completion_tokens", usage.CompletionTokens),
+		attribute.String("llm.finish_reason", resp.FinishReason), attribute.Int("llm.tool_calls", len(resp.Message.ToolCalls)))
+	appTrace.End(span, nil)
+	slog.InfoContext(ctx, "Model call", "model", req.Model, "messages", len(req.Messages), "promptTokens", usage.PromptTokens,
+		"completionTokens", usage.CompletionTokens, "finishReason", resp.FinishReason, "durationMs", time.Since(start).Milliseconds())
+	return resp, nil
+}
+
+// acquireModelSlot waits for a model call to be allowed to run, as only so many may run at once
+func (t *turn) acquireModelSlot(ctx context.Context) error {
+	ctx, span := appTrace.Start(ctx, "llm queue")
+	err := t.server.modelSlots.Acquire(ctx, t.state.UserID)
+	appTrace.End(span, err)
+	return err
+}
+
+// countUsage adds the tokens of a model call to the turn's usage, estimating them if the provider did not report them.
+// It returns the tokens counted.
+func (t *turn) countUsage(req llm.Request, resp *llm.Response) llm.Usage {
+	usage := resp.Usage
+	if usage.TotalTokens == 0 {
+		usage = llm.EstimateUsage(req, resp)
+	}
+	t.usage = t.usage.Add(usage)
+	return usage
+}
+
+// systemMessages returns the system messages sent before and after the user's conversation:
+// instructions including the project brief, and the current state of the files
+func (s *Server) systemMessages(currUserState *userStore.UserState) (llm.Message, llm.Message) {
+	var startSysMsg = llm.Message{
+		Role: llm.RoleSystem,
+		Content: `You are a helpful software engineer.
+			Currently we are working on a fresh React App boilerplate, with access to react-bootstrap, bootstrap and react-router-dom modules.
+			You are able to change App.js and App.css, for a web app which is updated live.
+			You can also create, rename and delete other files inside src, such as components, pages, CSS modules and JSON data files.
+			You are shown a list of the files rather than their code, so use read_file to read the files you need, and only those.
+			To change an existing file, use edit_file with small search and replace edits rather than rewriting the whole file.
+			After you call a tool you will be told whether it succeeded. If it failed, try to fix the problem.
+			JavaScript files are compiled before they are saved, and a file with syntax errors is rejected with the compiler's errors.
+
+			The user knows nothing about computer programming.
+			Therefore you must not say what you are doing under the hood when it comes to updating code.
+			You must be helpful and polite, and always give a brief description of what the website you created should look like.
+			If you were unable to make a change, say so honestly.
+			But remember, don't mention App.js or App.css or what you've done to the code, as this means nothing to the user!
+
+			You also have access to an S3 bucket folder for images ` + s.Images.URL(userFolder(currUserState.UserID)) + ".",
+	}
+
+	// Earlier requirements which no longer fit in the conversation
+	if currUserState.ProjectBrief != "" {
+		startSysMsg.Content += "\n\nThe start of the conversation has been summarised in this brief of the user's project, which you must still follow:\n" + currUserState.ProjectBrief
+	}
+
+	// System message at the end describing the current state of the files
+	endSysMsg := llm.Message{
+		Role:    llm.RoleSystem,
+		Content: currUserState.DirectoryState.CreateSysMsgState(),
+	}
+
+	return startSysMsg, endSysMsg
+}
+
+// executeToolCall applies a tool call to the user's app.
+// It returns the result to report back to the model, and whether the call succeeded.
+func (t *turn) executeToolCall(ctx context.Context, call llm.ToolCall) (string, bool) {
+	// The model may call tools which do not exist, which must not each get their own series or span name
+	toolLabel := call.Name
+	if !t.agent.tools.Has(call.Name) {
+		toolLabel = "unknown"
+	}
+	ctx, span := appTrace.Start(ctx, "tool "+toolLabel, attribute.String("tool.name", call.Name))
+
+	project := t.server.newProject(t.state)
+	project.OnChange = func(change funcTools.FileChange) {
+		span.SetAttributes(attribute.String("file.path", change.Path))
+		t.fileChanged(change)
+	}
+
+	result, err := t.agent.tools.Call(ctx, project, call.Name, call.Arguments)
+	appMetrics.ObserveToolCall(toolLabel, err)
+	appTrace.End(span, err)
+	if err != nil {
+		// Tool errors may quote the user's code
+		slog.InfoContext(ctx, "Tool call failed", "tool", call.Name, appLog.Content("arguments", call.Arguments), appLog.Content("error", err.Error()))
+		return fmt.Sprintf("Error: %v", err), false
+	}
+	slog.InfoContext(ctx, "Tool call", "tool", call.Name, appLog.Content("arguments", call.Arguments))
+	return result, true
+}
+
+// fileChanged streams the progress of a tool changing a file to the client.
+// Compile errors are kept for the response until the file is saved successfully.
+func (t *turn) fileChanged(change funcTools.FileChange) {
+	var compileErr *buildCheck.CompileError
+	switch {
+	case change.Status == funcTools.FILE_UPDATED:
+		delete(t.rejected, change.Path)
+	case errors.As(change.Err, &compileErr):
+		t.rejected[compileErr.File] = compileErr.Diagnostics
+	}
+
+	if t.emit != nil {
+		event := fileEvent{FileName: change.Path, Status: change.Status}
+		if change.Status == funcTools.FILE_FAILED {
+			event.Diagnostics = t.rejected[change.Path]
+		}
+		t.emit(EVENT_FILE, event)
+	}
+}
+
+// newProject returns the user's app, with its files mirrored to their folder of the app-code store
+func (s *Server) newProject(currUserState *userStore.UserState) *funcTools.Project {
+	return &funcTools.Project{
+		State:  &currUserState.DirectoryState,
+		Store:  s.AppFiles,
+		Prefix: userFolder(currUserState.UserID),
+	}
+}
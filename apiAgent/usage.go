@@ -0,0 +1,84 @@
+package apiAgent
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
+)
+
+// Days of daily totals returned by /api/usage
+const USAGE_DAYS = 31
+
+// usageSchema is the response of /api/usage.
+// Budget is the monthly budget in US dollars, or 0 if there is none.
+type usageSchema struct {
+	Month   userStore.UsageTotal   `json:"month"`
+	Budget  float64                `json:"budget"`
+	Daily   []userStore.UsageTotal `json:"daily"`
+	Monthly []userStore.UsageTotal `json:"monthly"`
+	Turns   []userStore.TurnUsage  `json:"turns"`
+}
+
+// quotaSchema is the response of /api/message once the user has spent their monthly budget.
+type quotaSchema struct {
+	Error    string    `json:"error"`
+	Message  string    `json:"message"`
+	Spent    float64   `json:"spent"`
+	Budget   float64   `json:"budget"`
+	ResetsAt time.Time `json:"resetsAt"`
+}
+
+// apiUsageHandler returns the tokens and estimated cost of the user's turns,
+// with totals for this month, each of the last 31 days and each month.
+func (s *Server) apiUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		currUserID := requestUser(r)
+
+		currUserState, err := s.loadUser(r.Context(), currUserID)
+		if err != nil {
+			http.Error(w, "Failed to find user of given credentials", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to find user of given credentials", "error", err)
+			return
+		}
+
+		now := time.Now()
+		usage := currUserState.Usage
+		response := usageSchema{
+			Month:   usage.Month(now),
+			Budget:  s.agent.Load().monthlyBudget,
+			Daily:   usage.Daily(now.AddDate(0, 0, -(USAGE_DAYS - 1))),
+			Monthly: usage.Monthly(),
+			Turns:   usage.Turns,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Error encoding JSON response", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error encoding JSON response", "error", err)
+		}
+	} else {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		slog.WarnContext(r.Context(), "Method not allowed", "method", r.Method)
+	}
+}
+
+// writeQuotaExceeded responds with 402 Payment Required, as the user has spent their monthly budget
+func writeQuotaExceeded(w http.ResponseWriter, spent float64, budget float64) {
+	now := time.Now().UTC()
+	response := quotaSchema{
+		Error:    "quota_exceeded",
+		Message:  "You have used all of this month's AI budget. It will reset at the start of next month.",
+		Spent:    spent,
+		Budget:   budget,
+		ResetsAt: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding JSON response", "error", err)
+	}
+}
@@ -0,0 +1,281 @@
+package appConfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the stores.userStore options
+const (
+	USER_STORE_DYNAMO = "dynamo"
+	USER_STORE_MEMORY = "memory"
+	USER_STORE_FILE   = "file"
+)
+
+// Names of the stores.blobStore options
+const (
+	BLOB_STORE_S3    = "s3"
+	BLOB_STORE_LOCAL = "local"
+)
+
+// Names of the ecs.launcher options
+const (
+	PREVIEW_LAUNCHER_ECS    = "ecs"
+	PREVIEW_LAUNCHER_MEMORY = "memory"
+	PREVIEW_LAUNCHER_NONE   = "none"
+)
+
+// Names of the llm.provider options
+const (
+	LLM_PROVIDER_OPENAI            = "openai"
+	LLM_PROVIDER_OPENAI_COMPATIBLE = "openai-compatible"
+	LLM_PROVIDER_SCRIPTED          = "scripted"
+)
+
+// Names of the auth.tokenUse options
+const (
+	TOKEN_USE_ACCESS = "access"
+	TOKEN_USE_ID     = "id"
+	TOKEN_USE_ANY    = "any"
+)
+
+// Names of the log.format options
+const (
+	LOG_FORMAT_JSON = "json"
+	LOG_FORMAT_TEXT = "text"
+)
+
+// Names of the trace.exporter options
+const (
+	TRACE_EXPORTER_NONE = "none"
+	TRACE_EXPORTER_OTLP = "otlp"
+	TRACE_EXPORTER_FILE = "file"
+)
+
+// Config is the configuration of the whole server.
+// Every setting can be given in the JSON config file under the path of its json tags,
+// in the environment variable of its env tag, or as a flag named by its path, e.g. -server.addr.
+type Config struct {
+	Environment string       `json:"environment" env:"APP_ENV" help:"name of the deployment, e.g. staging or production"`
+	Server      ServerConfig `json:"server"`
+	AWS         AWSConfig    `json:"aws"`
+	Stores      StoresConfig `json:"stores"`
+	ECS         ECSConfig    `json:"ecs"`
+	LLM         LLMConfig    `json:"llm"`
+	Agent       AgentConfig  `json:"agent"`
+	Limits      LimitsConfig `json:"limits"`
+	Auth        AuthConfig   `json:"auth"`
+	Log         LogConfig    `json:"log"`
+	Trace       TraceConfig  `json:"trace"`
+	Health      HealthConfig `json:"health"`
+}
+
+// ServerConfig is where the server listens, who may call it, and how long requests may take.
+type ServerConfig struct {
+	Addr                     string `json:"addr" env:"ADDR" help:"address the server listens on"`
+	CORSOrigin               string `json:"corsOrigin" env:"CORS_ORIGIN" help:"origin of the frontend allowed to call the API"`
+	PublicURL                string `json:"publicUrl" env:"PUBLIC_URL" help:"address this server is reached at, for serving the local blob stores"`
+	TrustedProxies           int    `json:"trustedProxies" env:"TRUSTED_PROXIES" help:"proxies in front of the server, such as the load balancer, whose X-Forwarded-For entries are trusted for clients' IP addresses"`
+	ReadHeaderTimeoutSeconds int    `json:"readHeaderTimeoutSeconds" env:"READ_HEADER_TIMEOUT_SECONDS" help:"longest a client may take to send a request's headers"`
+	ReadTimeoutSeconds       int    `json:"readTimeoutSeconds" env:"READ_TIMEOUT_SECONDS" help:"longest a client may take to send a whole request, or 0 for no limit"`
+	WriteTimeoutSeconds      int    `json:"writeTimeoutSeconds" env:"WRITE_TIMEOUT_SECONDS" help:"longest a response may take, other than a message's, or 0 for no limit"`
+	IdleTimeoutSeconds       int    `json:"idleTimeoutSeconds" env:"IDLE_TIMEOUT_SECONDS" help:"longest an idle keep-alive connection is kept open"`
+	TurnTimeoutSeconds       int    `json:"turnTimeoutSeconds" env:"TURN_TIMEOUT_SECONDS" help:"longest a message to the AI may take, including its tool calls and repairs"`
+	ShutdownTimeoutSeconds   int    `json:"shutdownTimeoutSeconds" env:"SHUTDOWN_TIMEOUT_SECONDS" help:"longest to wait for requests to finish on SIGTERM before exiting"`
+}
+
+// AWSConfig is the AWS account and region everything is run in.
+type AWSConfig struct {
+	Region    string `json:"region" env:"AWS_REGION" help:"AWS region"`
+	AccountID string `json:"accountId" env:"AWS_ACCOUNT_ID" help:"AWS account ID, of the ECR registry and ECS execution role"`
+}
+
+// StoresConfig is where users' state, images and app code are kept.
+type StoresConfig struct {
+	UserStore    string `json:"userStore" env:"USER_STORE" help:"user store: dynamo, memory or file"`
+	UserStoreDir string `json:"userStoreDir" env:"USER_STORE_DIR" help:"directory of the file user store"`
+	DynamoTable  string `json:"dynamoTable" env:"DYNAMO_DB_TABLE" help:"DynamoDB table of the dynamo user store"`
+	BlobStore    string `json:"blobStore" env:"BLOB_STORE" help:"blob store: s3 or local"`
+	BlobStoreDir string `json:"blobStoreDir" env:"BLOB_STORE_DIR" help:"directory of the local blob stores"`
+	ImagesBucket string `json:"imagesBucket" env:"S3_BUCKET" help:"S3 bucket of users' images"`
+	AppBucket    string `json:"appBucket" env:"S3_BUCKET_APP" help:"S3 bucket of the code of users' apps"`
+}
+
+// ECSConfig is where the containers previewing users' apps are built and run.
+type ECSConfig struct {
+	Launcher           string   `json:"launcher" env:"PREVIEW_LAUNCHER" help:"launcher of users' preview tasks: ecs, memory or none"`
+	Cluster            string   `json:"cluster" env:"ECS_CLUSTER_NAME" help:"ECS cluster the preview tasks run in"`
+	Subnets            []string `json:"subnets" env:"ECS_SUBNETS" help:"comma-separated subnet IDs of the preview tasks"`
+	SecurityGroups     []string `json:"securityGroups" env:"ECS_SECURITY_GROUPS" help:"comma-separated security group IDs of the preview tasks"`
+	ExecutionRole      string   `json:"executionRole" env:"ECS_EXECUTION_ROLE" help:"name or ARN of the preview tasks' execution role"`
+	Repository         string   `json:"repository" env:"ECR_REPOSITORY" help:"ECR repository of the preview image"`
+	AppDir             string   `json:"appDir" env:"REACT_APP_DIR" help:"directory of the preview image's Dockerfile"`
+	IdleMinutes        int      `json:"idleMinutes" env:"PREVIEW_IDLE_MINUTES" help:"minutes a preview task is kept running after its user was last active, or 0 for no limit"`
+	MaxLifetimeMinutes int      `json:"maxLifetimeMinutes" env:"PREVIEW_MAX_LIFETIME_MINUTES" help:"longest a preview task may run, or 0 for no limit"`
+}
+
+// LLMConfig is the model the agent chats with, and what it costs.
+type LLMConfig struct {
+	Provider        string   `json:"provider" env:"LLM_PROVIDER" help:"LLM provider: openai, openai-compatible or scripted"`
+	Model           string   `json:"model" env:"LLM_MODEL" help:"model name"`
+	OpenAIAPIKey    string   `json:"openaiApiKey" env:"OPENAI_API_KEY" help:"OpenAI API key, read from Secrets Manager if not set"`
+	SecretID        string   `json:"secretId" env:"OPENAI_SECRET_ID" help:"Secrets Manager secret holding the OpenAI API key"`
+	BaseURL         string   `json:"baseUrl" env:"LLM_BASE_URL" help:"address of the openai-compatible server"`
+	APIKey          string   `json:"apiKey" env:"LLM_API_KEY" help:"API key of the openai-compatible server"`
+	Script          string   `json:"script" env:"LLM_SCRIPT" help:"script file of the scripted provider"`
+	ContextWindow   int      `json:"contextWindow" env:"LLM_CONTEXT_WINDOW" help:"tokens the model can handle in one request, or 0 for the model's known size"`
+	PricePrompt     *float64 `json:"pricePrompt" env:"LLM_PRICE_PROMPT" help:"US dollars per million prompt tokens, overriding the model's known price"`
+	PriceCompletion *float64 `json:"priceCompletion" env:"LLM_PRICE_COMPLETION" help:"US dollars per million completion tokens, overriding the model's known price"`
+	MonthlyBudget   float64  `json:"monthlyBudget" env:"MONTHLY_BUDGET_USD" help:"most each user may spend a month in US dollars, or 0 for no limit"`
+}
+
+// AgentConfig bounds the work done in one turn.
+type AgentConfig struct {
+	MaxSteps          int `json:"maxSteps" env:"AGENT_MAX_STEPS" help:"most tool-calling steps the model may take in a turn"`
+	RepairMaxAttempts int `json:"repairMaxAttempts" env:"REPAIR_MAX_ATTEMPTS" help:"most rounds spent fixing build errors in a turn, or 0 for none"`
+}
+
+// LimitsConfig is the rate limits of messages, and of the model calls running at once.
+type LimitsConfig struct {
+	UserPerMinute       int `json:"userPerMinute" env:"RATE_LIMIT_USER_PER_MINUTE" help:"messages per minute for each user, or 0 for no limit"`
+	UserBurst           int `json:"userBurst" env:"RATE_LIMIT_USER_BURST" help:"messages each user may send at once"`
+	IPPerMinute         int `json:"ipPerMinute" env:"RATE_LIMIT_IP_PER_MINUTE" help:"messages per minute from each IP address, or 0 for no limit"`
+	IPBurst             int `json:"ipBurst" env:"RATE_LIMIT_IP_BURST" help:"messages each IP address may send at once"`
+	MaxConcurrent       int `json:"maxConcurrent" env:"LLM_MAX_CONCURRENT" help:"model calls running at once"`
+	MaxQueued           int `json:"maxQueued" env:"LLM_MAX_QUEUED" help:"model calls waiting for a slot"`
+	QueueTimeoutSeconds int `json:"queueTimeoutSeconds" env:"LLM_QUEUE_TIMEOUT_SECONDS" help:"longest a model call waits for a slot"`
+	PreviewPerMinute    int `json:"previewPerMinute" env:"RATE_LIMIT_PREVIEW_PER_MINUTE" help:"preview requests per minute for each user, or 0 for no limit"`
+	PreviewBurst        int `json:"previewBurst" env:"RATE_LIMIT_PREVIEW_BURST" help:"preview requests each user may send at once"`
+}
+
+// AuthConfig is who issues the tokens requests are authenticated with.
+type AuthConfig struct {
+	Issuer    string `json:"issuer" env:"AUTH_ISSUER" help:"issuer of the tokens"`
+	Audience  string `json:"audience" env:"AUTH_AUDIENCE" help:"audience of the tokens, the app client ID"`
+	JWKSURL   string `json:"jwksUrl" env:"AUTH_JWKS_URL" help:"address of the issuer's JWKS, by default <issuer>/.well-known/jwks.json"`
+	JWKSFile  string `json:"jwksFile" env:"AUTH_JWKS_FILE" help:"local JWKS file, read instead of fetching the JWKS"`
+	UserClaim string `json:"userClaim" env:"AUTH_USER_CLAIM" help:"claim holding the user ID"`
+	TokenUse  string `json:"tokenUse" env:"AUTH_TOKEN_USE" help:"kind of token accepted, by its token_use claim: access, id or any"`
+	Disabled  bool   `json:"disabled" env:"AUTH_DISABLED" help:"trust the username header instead of tokens, for local development only"`
+}
+
+// LogConfig is how much is logged, and how.
+type LogConfig struct {
+	Level   string `json:"level" env:"LOG_LEVEL" help:"lowest level logged: debug, info, warn or error"`
+	Format  string `json:"format" env:"LOG_FORMAT" help:"log format: json or text"`
+	Content bool   `json:"content" env:"LOG_CONTENT" help:"log messages, prompts and code at debug level, which may hold personal data"`
+}
+
+// TraceConfig is where the traces of requests are sent.
+type TraceConfig struct {
+	Exporter    string  `json:"exporter" env:"TRACE_EXPORTER" help:"trace exporter: none, otlp or file"`
+	Endpoint    string  `json:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" help:"address of the OTLP/HTTP collector, by default http://localhost:4318"`
+	File        string  `json:"file" env:"TRACE_FILE" help:"file the file exporter appends spans to, one JSON object per line"`
+	SampleRatio float64 `json:"sampleRatio" env:"TRACE_SAMPLE_RATIO" help:"fraction of requests traced, from 0 to 1"`
+	ServiceName string  `json:"serviceName" env:"OTEL_SERVICE_NAME" help:"name of the service in the traces"`
+}
+
+// HealthConfig is how the readiness checks are run.
+type HealthConfig struct {
+	CacheSeconds   int `json:"cacheSeconds" env:"HEALTH_CACHE_SECONDS" help:"how long the readiness checks' results are reused, so probes do not each call AWS"`
+	TimeoutSeconds int `json:"timeoutSeconds" env:"HEALTH_TIMEOUT_SECONDS" help:"longest each readiness check may take"`
+}
+
+// Default returns the configuration of the production deployment
+func Default() *Config {
+	return &Config{
+		Environment: "production",
+		Server: ServerConfig{
+			Addr:           ":80",
+			CORSOrigin:     "https://stephencowley.com",
+			PublicURL:      "http://localhost:80",
+			TrustedProxies: 1, // the application load balancer
+
+			ReadHeaderTimeoutSeconds: 10,
+			ReadTimeoutSeconds:       60,
+			WriteTimeoutSeconds:      60,
+			IdleTimeoutSeconds:       120,
+			TurnTimeoutSeconds:       180,
+			ShutdownTimeoutSeconds:   210,
+		},
+		AWS: AWSConfig{
+			Region:    "eu-west-2",
+			AccountID: "211125355525",
+		},
+		Stores: StoresConfig{
+			UserStore:    USER_STORE_DYNAMO,
+			UserStoreDir: "data/users",
+			DynamoTable:  "programming-agent-users",
+			BlobStore:    BLOB_STORE_S3,
+			BlobStoreDir: "data/blobs",
+			ImagesBucket: "my-programming-agent-img-store",
+			AppBucket:    "test-stack-bucket-program-agent",
+		},
+		ECS: ECSConfig{
+			Launcher:           PREVIEW_LAUNCHER_ECS,
+			Cluster:            "ProjectCluster2",
+			Subnets:            []string{"subnet-05b3b838935e29eeb"},
+			SecurityGroups:     []string{"sg-07d875c0a076ceeba"},
+			ExecutionRole:      "MyFargateExecutionRole",
+			Repository:         "programming-agent-ui",
+			AppDir:             "/home/ubuntu/user-react-app",
+			IdleMinutes:        30,
+			MaxLifetimeMinutes: 480,
+		},
+		LLM: LLMConfig{
+			Provider: LLM_PROVIDER_OPENAI,
+			Model:    "gpt-4o",
+			SecretID: "open-ai-api-key",
+		},
+		Agent: AgentConfig{
+			MaxSteps:          5,
+			RepairMaxAttempts: 2,
+		},
+		Limits: LimitsConfig{
+			UserPerMinute:       10,
+			UserBurst:           5,
+			IPPerMinute:         30,
+			IPBurst:             15,
+			MaxConcurrent:       8,
+			MaxQueued:           64,
+			QueueTimeoutSeconds: 30,
+			PreviewPerMinute:    30,
+			PreviewBurst:        10,
+		},
+		Auth: AuthConfig{
+			TokenUse: TOKEN_USE_ACCESS,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LOG_FORMAT_JSON,
+		},
+		Trace: TraceConfig{
+			Exporter:    TRACE_EXPORTER_NONE,
+			File:        "data/traces.jsonl",
+			SampleRatio: 1,
+			ServiceName: "programming-agent-server",
+		},
+		Health: HealthConfig{
+			CacheSeconds:   10,
+			TimeoutSeconds: 3,
+		},
+	}
+}
+
+// ECRRegistry is the address of the account's ECR registry
+func (c *Config) ECRRegistry() string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", c.AWS.AccountID, c.AWS.Region)
+}
+
+// ECRImage is the address of the preview image in the ECR registry
+func (c *Config) ECRImage() string {
+	return c.ECRRegistry() + "/" + c.ECS.Repository + ":latest"
+}
+
+// ExecutionRoleARN is the ARN of the preview tasks' execution role, which may be configured by name alone
+func (c *Config) ExecutionRoleARN() string {
+	if strings.HasPrefix(c.ECS.ExecutionRole, "arn:") {
+		return c.ECS.ExecutionRole
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", c.AWS.AccountID, c.ECS.ExecutionRole)
+}
@@ -0,0 +1,176 @@
+package appConfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// setting is a single configurable field, found by walking the Config.
+type setting struct {
+	Path  string // the json tags of the field and its parents, joined by dots
+	Env   string
+	Help  string
+	Value reflect.Value
+}
+
+// Load reads the configuration from, in increasing priority, the defaults, the JSON file given by the -config flag
+// or CONFIG_FILE environment variable, the environment, and the flags in args. The result is validated.
+func Load(args []string) (*Config, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "JSON config file ($CONFIG_FILE)")
+	// Flags are only applied if given, so their defaults are just for the usage message
+	for _, s := range settings(config) {
+		usage := fmt.Sprintf("%s ($%s)", s.Help, s.Env)
+		if s.Value.Kind() == reflect.Bool {
+			flags.Bool(s.Path, s.Value.Bool(), usage)
+		} else {
+			flags.String(s.Path, formatValue(s.Value), usage)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(config, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Empty environment variables are treated as unset, as in a .env file with blank values
+	all := settings(config)
+	for _, s := range all {
+		value := os.Getenv(s.Env)
+		if value == "" {
+			continue
+		}
+		if err := setValue(s.Value, value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", s.Env, value, err)
+		}
+	}
+
+	flagValues := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) { flagValues[f.Name] = f.Value.String() })
+	for _, s := range all {
+		value, exists := flagValues[s.Path]
+		if !exists {
+			continue
+		}
+		if err := setValue(s.Value, value); err != nil {
+			return nil, fmt.Errorf("invalid -%s %q: %w", s.Path, value, err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadFile overlays the settings in the JSON file onto the config. Unknown settings are an error, as they are probably misspelt.
+func loadFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// settings lists every configurable field of the config
+func settings(config *Config) []setting {
+	var result []setting
+	walk(reflect.ValueOf(config).Elem(), "", &result)
+	return result
+}
+
+// walk adds the fields of the struct to the settings, descending into nested structs
+func walk(v reflect.Value, prefix string, result *[]setting) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		path := prefix + field.Tag.Get("json")
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), path+".", result)
+			continue
+		}
+		*result = append(*result, setting{Path: path, Env: field.Tag.Get("env"), Help: field.Tag.Get("help"), Value: v.Field(i)})
+	}
+}
+
+// formatValue writes the field as it would be given in an environment variable or flag
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return formatValue(v.Elem())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// setValue parses the text into the field. Lists are comma-separated.
+func setValue(v reflect.Value, text string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(value)
+	case reflect.Int:
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		v.SetInt(int64(value))
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(value)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Pointer:
+		// An empty value unsets an optional setting
+		if text == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		value := reflect.New(v.Type().Elem())
+		if err := setValue(value.Elem(), text); err != nil {
+			return err
+		}
+		v.Set(value)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
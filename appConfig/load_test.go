@@ -0,0 +1,169 @@
+package appConfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every setting's environment variable for the test, so the environment running the tests cannot change their results
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for _, s := range settings(Default()) {
+		t.Setenv(s.Env, "")
+	}
+	// Settings without a value are required, so give them in every test
+	t.Setenv("AUTH_ISSUER", "https://issuer.example.com")
+	t.Setenv("AUTH_AUDIENCE", "client123")
+}
+
+// writeConfigFile writes the JSON config file for the test, returning its path
+func writeConfigFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, `{
+		"environment": "staging",
+		"server": {"addr": ":1", "corsOrigin": "https://staging.example.com"},
+		"llm": {"model": "file-model"},
+		"log": {"level": "debug"}
+	}`)
+	t.Setenv("ADDR", ":2")
+	t.Setenv("LLM_MODEL", "env-model")
+
+	config, err := Load([]string{"-config", path, "-server.addr=:3"})
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"default", config.Limits.UserBurst, Default().Limits.UserBurst},
+		{"file over default", config.Server.CORSOrigin, "https://staging.example.com"},
+		{"file over default, top level", config.Environment, "staging"},
+		{"file kept where not overridden", config.Log.Level, "debug"},
+		{"env over file", config.LLM.Model, "env-model"},
+		{"flag over env and file", config.Server.Addr, ":3"},
+		{"nested default beside file settings", config.Server.TurnTimeoutSeconds, Default().Server.TurnTimeoutSeconds},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %v, want %v", test.got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `{"environment": "from-env"}`))
+
+	config, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if config.Environment != "from-env" {
+		t.Errorf("environment = %q, want it from $CONFIG_FILE", config.Environment)
+	}
+
+	// The -config flag takes priority over the variable
+	config, err = Load([]string{"-config", writeConfigFile(t, `{"environment": "from-flag"}`)})
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if config.Environment != "from-flag" {
+		t.Errorf("environment = %q, want it from -config", config.Environment)
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	price := 2.5
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(c *Config) any
+		want  any
+	}{
+		{"string env", map[string]string{"ECS_CLUSTER_NAME": "Staging"}, nil, func(c *Config) any { return c.ECS.Cluster }, "Staging"},
+		{"string flag", nil, []string{"-ecs.cluster=Staging"}, func(c *Config) any { return c.ECS.Cluster }, "Staging"},
+		{"int env", map[string]string{"RATE_LIMIT_USER_BURST": "7"}, nil, func(c *Config) any { return c.Limits.UserBurst }, 7},
+		{"int flag", nil, []string{"-limits.userBurst", "7"}, func(c *Config) any { return c.Limits.UserBurst }, 7},
+		{"float env", map[string]string{"TRACE_SAMPLE_RATIO": "0.25"}, nil, func(c *Config) any { return c.Trace.SampleRatio }, 0.25},
+		{"bool env", map[string]string{"LOG_CONTENT": "true"}, nil, func(c *Config) any { return c.Log.Content }, true},
+		{"bool flag without a value", nil, []string{"-log.content"}, func(c *Config) any { return c.Log.Content }, true},
+		{"bool flag set false", map[string]string{"LOG_CONTENT": "true"}, []string{"-log.content=false"}, func(c *Config) any { return c.Log.Content }, false},
+		{"list env", map[string]string{"ECS_SUBNETS": "subnet-a, subnet-b,,"}, nil, func(c *Config) any { return c.ECS.Subnets }, []string{"subnet-a", "subnet-b"}},
+		{"list flag", nil, []string{"-ecs.subnets=subnet-c"}, func(c *Config) any { return c.ECS.Subnets }, []string{"subnet-c"}},
+		{"optional env", map[string]string{"LLM_PRICE_PROMPT": "2.5"}, nil, func(c *Config) any { return c.LLM.PricePrompt }, &price},
+		{"optional flag", nil, []string{"-llm.pricePrompt=2.5"}, func(c *Config) any { return c.LLM.PricePrompt }, &price},
+		{"optional unset by an empty flag", map[string]string{"LLM_PRICE_PROMPT": "2.5"}, []string{"-llm.pricePrompt="}, func(c *Config) any { return c.LLM.PricePrompt }, (*float64)(nil)},
+		{"empty env is unset", map[string]string{"ADDR": ""}, nil, func(c *Config) any { return c.Server.Addr }, Default().Server.Addr},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			config, err := Load(test.args)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if got := test.check(config); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		file    string
+		wantErr string
+	}{
+		{name: "bad int env", env: map[string]string{"RATE_LIMIT_USER_BURST": "many"}, wantErr: `invalid RATE_LIMIT_USER_BURST "many": must be a whole number`},
+		{name: "bad bool env", env: map[string]string{"AUTH_DISABLED": "yes please"}, wantErr: `invalid AUTH_DISABLED "yes please": must be true or false`},
+		{name: "bad float flag", args: []string{"-trace.sampleRatio=half"}, wantErr: `invalid -trace.sampleRatio "half": must be a number`},
+		{name: "unknown flag", args: []string{"-server.adr=:80"}, wantErr: "flag provided but not defined: -server.adr"},
+		{name: "unknown file setting", file: `{"server": {"adr": ":80"}}`, wantErr: `unknown field "adr"`},
+		{name: "file of the wrong type", file: `{"limits": {"userBurst": "5"}}`, wantErr: "invalid config file"},
+		{name: "missing file", args: []string{"-config", "missing.json"}, wantErr: "failed to read the config file"},
+		{name: "invalid result", env: map[string]string{"LOG_LEVEL": "loud"}, wantErr: `unknown log.level "loud"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			args := test.args
+			if test.file != "" {
+				args = append(args, "-config", writeConfigFile(t, test.file))
+			}
+			_, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Load() = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
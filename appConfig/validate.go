@@ -0,0 +1,91 @@
+package appConfig
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+)
+
+// AWS account IDs are twelve digits
+var accountID = regexp.MustCompile(`^\d{12}$`)
+
+// Validate checks that the settings make sense together, reporting every problem found
+func (c *Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr must be set")
+	check(c.Server.ReadHeaderTimeoutSeconds >= 0 && c.Server.ReadTimeoutSeconds >= 0 && c.Server.WriteTimeoutSeconds >= 0 && c.Server.IdleTimeoutSeconds >= 0,
+		"the server timeouts must not be negative")
+	check(c.Server.TurnTimeoutSeconds >= 1, "server.turnTimeoutSeconds must be at least 1")
+	check(c.Server.ShutdownTimeoutSeconds >= 1, "server.shutdownTimeoutSeconds must be at least 1")
+	check(c.Server.TrustedProxies >= 0, "server.trustedProxies must not be negative")
+
+	usesAWS := c.Stores.UserStore == USER_STORE_DYNAMO || c.Stores.BlobStore == BLOB_STORE_S3 || c.ECS.Launcher == PREVIEW_LAUNCHER_ECS ||
+		(c.LLM.Provider == LLM_PROVIDER_OPENAI && c.LLM.OpenAIAPIKey == "")
+	check(!usesAWS || c.AWS.Region != "", "aws.region must be set to use AWS")
+	check(c.AWS.AccountID == "" || accountID.MatchString(c.AWS.AccountID), "aws.accountId %q must be twelve digits", c.AWS.AccountID)
+
+	check(slices.Contains([]string{USER_STORE_DYNAMO, USER_STORE_MEMORY, USER_STORE_FILE}, c.Stores.UserStore),
+		"unknown stores.userStore %q", c.Stores.UserStore)
+	check(c.Stores.UserStore != USER_STORE_DYNAMO || c.Stores.DynamoTable != "", "stores.dynamoTable must be set for the dynamo user store")
+	check(c.Stores.UserStore != USER_STORE_FILE || c.Stores.UserStoreDir != "", "stores.userStoreDir must be set for the file user store")
+	check(slices.Contains([]string{BLOB_STORE_S3, BLOB_STORE_LOCAL}, c.Stores.BlobStore),
+		"unknown stores.blobStore %q", c.Stores.BlobStore)
+	check(c.Stores.BlobStore != BLOB_STORE_S3 || (c.Stores.ImagesBucket != "" && c.Stores.AppBucket != ""),
+		"stores.imagesBucket and stores.appBucket must be set for the s3 blob store")
+	check(c.Stores.BlobStore != BLOB_STORE_LOCAL || (c.Stores.BlobStoreDir != "" && c.Server.PublicURL != ""),
+		"stores.blobStoreDir and server.publicUrl must be set for the local blob store")
+
+	check(slices.Contains([]string{PREVIEW_LAUNCHER_ECS, PREVIEW_LAUNCHER_MEMORY, PREVIEW_LAUNCHER_NONE}, c.ECS.Launcher),
+		"unknown ecs.launcher %q", c.ECS.Launcher)
+	check(c.ECS.Launcher != PREVIEW_LAUNCHER_ECS || (c.ECS.Cluster != "" && c.ECS.Repository != "" && len(c.ECS.Subnets) != 0),
+		"ecs.cluster, ecs.repository and ecs.subnets must be set for the ecs launcher")
+	check(c.ECS.IdleMinutes >= 0 && c.ECS.MaxLifetimeMinutes >= 0, "ecs.idleMinutes and ecs.maxLifetimeMinutes must not be negative")
+
+	check(slices.Contains([]string{LLM_PROVIDER_OPENAI, LLM_PROVIDER_OPENAI_COMPATIBLE, LLM_PROVIDER_SCRIPTED}, c.LLM.Provider),
+		"unknown llm.provider %q", c.LLM.Provider)
+	check(c.LLM.Provider != LLM_PROVIDER_OPENAI || c.LLM.OpenAIAPIKey != "" || c.LLM.SecretID != "",
+		"llm.openaiApiKey or llm.secretId must be set for the openai provider")
+	check(c.LLM.Provider != LLM_PROVIDER_OPENAI_COMPATIBLE || c.LLM.BaseURL != "", "llm.baseUrl must be set for an openai-compatible provider")
+	check(c.LLM.Provider != LLM_PROVIDER_SCRIPTED || c.LLM.Script != "", "llm.script must be set for a scripted provider")
+	check(c.LLM.Model != "", "llm.model must be set")
+	check(c.LLM.ContextWindow >= 0, "llm.contextWindow must not be negative")
+	check(c.LLM.PricePrompt == nil || *c.LLM.PricePrompt >= 0, "llm.pricePrompt must not be negative")
+	check(c.LLM.PriceCompletion == nil || *c.LLM.PriceCompletion >= 0, "llm.priceCompletion must not be negative")
+	check(c.LLM.MonthlyBudget >= 0, "llm.monthlyBudget must not be negative")
+
+	check(c.Agent.MaxSteps >= 1, "agent.maxSteps must be at least 1")
+	check(c.Agent.RepairMaxAttempts >= 0, "agent.repairMaxAttempts must not be negative")
+
+	check(c.Limits.UserPerMinute >= 0 && c.Limits.UserBurst >= 0 && c.Limits.IPPerMinute >= 0 && c.Limits.IPBurst >= 0 &&
+		c.Limits.PreviewPerMinute >= 0 && c.Limits.PreviewBurst >= 0,
+		"the rate limits must not be negative")
+	check(c.Limits.MaxConcurrent >= 1, "limits.maxConcurrent must be at least 1")
+	check(c.Limits.MaxQueued >= 0 && c.Limits.QueueTimeoutSeconds >= 0, "limits.maxQueued and limits.queueTimeoutSeconds must not be negative")
+
+	check(c.Auth.Disabled || (c.Auth.Issuer != "" && c.Auth.Audience != ""),
+		"auth.issuer ($AUTH_ISSUER) and auth.audience ($AUTH_AUDIENCE) must be set, or auth.disabled for local development")
+	check(slices.Contains([]string{TOKEN_USE_ACCESS, TOKEN_USE_ID, TOKEN_USE_ANY}, c.Auth.TokenUse), "unknown auth.tokenUse %q", c.Auth.TokenUse)
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "unknown log.level %q", c.Log.Level)
+	check(slices.Contains([]string{LOG_FORMAT_JSON, LOG_FORMAT_TEXT}, c.Log.Format), "unknown log.format %q", c.Log.Format)
+
+	check(slices.Contains([]string{TRACE_EXPORTER_NONE, TRACE_EXPORTER_OTLP, TRACE_EXPORTER_FILE}, c.Trace.Exporter),
+		"unknown trace.exporter %q", c.Trace.Exporter)
+	check(c.Trace.Exporter != TRACE_EXPORTER_FILE || c.Trace.File != "", "trace.file must be set for the file exporter")
+	check(c.Trace.SampleRatio >= 0 && c.Trace.SampleRatio <= 1, "trace.sampleRatio must be from 0 to 1")
+	check(c.Trace.ServiceName != "", "trace.serviceName must be set")
+
+	check(c.Health.CacheSeconds >= 0, "health.cacheSeconds must not be negative")
+	check(c.Health.TimeoutSeconds >= 1, "health.timeoutSeconds must be at least 1")
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,79 @@
+package appConfig
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig returns the default config with the settings which have no default
+func validConfig() *Config {
+	config := Default()
+	config.Auth.Issuer, config.Auth.Audience = "https://issuer.example.com", "client123"
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	negative := -1.0
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr []string // parts of the error, one for each problem, or none if the config is valid
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{name: "local development", change: func(c *Config) {
+			c.Stores.UserStore, c.Stores.BlobStore, c.ECS.Launcher = USER_STORE_FILE, BLOB_STORE_LOCAL, PREVIEW_LAUNCHER_MEMORY
+			c.LLM.Provider, c.LLM.Script, c.AWS.Region = LLM_PROVIDER_SCRIPTED, "script.json", ""
+			c.Auth = AuthConfig{Disabled: true, TokenUse: TOKEN_USE_ANY}
+		}},
+		{name: "no auth", change: func(c *Config) { c.Auth.Issuer = "" }, wantErr: []string{"auth.issuer ($AUTH_ISSUER) and auth.audience ($AUTH_AUDIENCE) must be set"}},
+		{name: "unknown token use", change: func(c *Config) { c.Auth.TokenUse = "refresh" }, wantErr: []string{`unknown auth.tokenUse "refresh"`}},
+		{name: "no address", change: func(c *Config) { c.Server.Addr = "" }, wantErr: []string{"server.addr must be set"}},
+		{name: "negative timeout", change: func(c *Config) { c.Server.ReadTimeoutSeconds = -1 }, wantErr: []string{"the server timeouts must not be negative"}},
+		{name: "negative proxies", change: func(c *Config) { c.Server.TrustedProxies = -1 }, wantErr: []string{"server.trustedProxies must not be negative"}},
+		{name: "AWS without a region", change: func(c *Config) { c.AWS.Region = "" }, wantErr: []string{"aws.region must be set to use AWS"}},
+		{name: "bad account ID", change: func(c *Config) { c.AWS.AccountID = "1234" }, wantErr: []string{`aws.accountId "1234" must be twelve digits`}},
+		{name: "unknown user store", change: func(c *Config) { c.Stores.UserStore = "redis" }, wantErr: []string{`unknown stores.userStore "redis"`}},
+		{name: "file store without a directory", change: func(c *Config) { c.Stores.UserStore, c.Stores.UserStoreDir = USER_STORE_FILE, "" },
+			wantErr: []string{"stores.userStoreDir must be set"}},
+		{name: "s3 without buckets", change: func(c *Config) { c.Stores.AppBucket = "" }, wantErr: []string{"stores.imagesBucket and stores.appBucket must be set"}},
+		{name: "ecs without subnets", change: func(c *Config) { c.ECS.Subnets = nil }, wantErr: []string{"ecs.cluster, ecs.repository and ecs.subnets must be set"}},
+		{name: "openai without a key", change: func(c *Config) { c.LLM.SecretID = "" }, wantErr: []string{"llm.openaiApiKey or llm.secretId must be set"}},
+		{name: "compatible without an address", change: func(c *Config) { c.LLM.Provider = LLM_PROVIDER_OPENAI_COMPATIBLE },
+			wantErr: []string{"llm.baseUrl must be set"}},
+		{name: "negative price", change: func(c *Config) { c.LLM.PricePrompt = &negative }, wantErr: []string{"llm.pricePrompt must not be negative"}},
+		{name: "no steps", change: func(c *Config) { c.Agent.MaxSteps = 0 }, wantErr: []string{"agent.maxSteps must be at least 1"}},
+		{name: "no concurrency", change: func(c *Config) { c.Limits.MaxConcurrent = 0 }, wantErr: []string{"limits.maxConcurrent must be at least 1"}},
+		{name: "unknown log level", change: func(c *Config) { c.Log.Level = "loud" }, wantErr: []string{`unknown log.level "loud"`}},
+		{name: "file exporter without a file", change: func(c *Config) { c.Trace.Exporter, c.Trace.File = TRACE_EXPORTER_FILE, "" },
+			wantErr: []string{"trace.file must be set for the file exporter"}},
+		{name: "sample ratio above 1", change: func(c *Config) { c.Trace.SampleRatio = 2 }, wantErr: []string{"trace.sampleRatio must be from 0 to 1"}},
+		{name: "every problem reported", change: func(c *Config) { c.Server.Addr, c.Agent.MaxSteps, c.Log.Format = "", 0, "xml" },
+			wantErr: []string{"server.addr must be set", "agent.maxSteps must be at least 1", `unknown log.format "xml"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := validConfig()
+			test.change(config)
+			err := config.Validate()
+			if len(test.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors containing %q", test.wantErr)
+			}
+			problems := strings.Split(err.Error(), "\n")
+			if len(problems) != len(test.wantErr) {
+				t.Errorf("Validate() = %q, want %d problems", err, len(test.wantErr))
+			}
+			for _, want := range test.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package appLog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// REDACTED replaces the value of a secret, or of content logged above debug level
+const REDACTED = "[REDACTED]"
+
+// Keys whose values are always redacted, compared ignoring case, e.g. an Authorization header or an API key
+var secretKeys = []string{"authorization", "cookie", "password", "secret", "token", "accesstoken", "idtoken", "apikey", "api_key"}
+
+// New creates the logger configured by the log settings, writing one JSON or text record per line to w.
+// The request ID and other attributes added to a context by WithRequestID and AddAttrs are included in every record
+// logged with that context, e.g. by slog.InfoContext.
+func New(w io.Writer, settings appConfig.LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(settings.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", settings.Level, err)
+	}
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactSecret}
+	var handler slog.Handler
+	switch settings.Format {
+	case appConfig.LOG_FORMAT_JSON:
+		handler = slog.NewJSONHandler(w, options)
+	case appConfig.LOG_FORMAT_TEXT:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", settings.Format)
+	}
+
+	showContent := settings.Content && level <= slog.LevelDebug
+	return slog.New(&contextHandler{next: handler, showContent: showContent}), nil
+}
+
+// Setup makes the configured logger the default, also used by the log package
+func Setup(w io.Writer, settings appConfig.LogConfig) error {
+	logger, err := New(w, settings)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// redactSecret hides the values of secretKeys whatever the level
+func redactSecret(groups []string, a slog.Attr) slog.Attr {
+	if slices.Contains(secretKeys, strings.ToLower(a.Key)) {
+		return slog.String(a.Key, REDACTED)
+	}
+	return a
+}
+
+// content is text from users or the model, e.g. a message, a prompt or code, which may hold personal data.
+type content string
+
+// Content logs text from users or the model under the key. It is only written by debug records,
+// and only if log.content is set; otherwise just its length is.
+func Content(key string, text string) slog.Attr {
+	return slog.Any(key, content(text))
+}
+
+// contextHandler adds the attributes of the context to each record, including the ID of its trace if it has one,
+// and redacts Content.
+type contextHandler struct {
+	next        slog.Handler
+	showContent bool
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	show := h.showContent && r.Level <= slog.LevelDebug
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	redacted.AddAttrs(contextAttrs(ctx)...)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		redacted.AddAttrs(slog.String("traceId", spanContext.TraceID().String()))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactContent(a, show))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts Content whatever the level, as the level of the records is not yet known
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactContent(a, false)
+	}
+	return &contextHandler{next: h.next.WithAttrs(redacted), showContent: h.showContent}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name), showContent: h.showContent}
+}
+
+// redactContent replaces Content, including in groups, by its length unless it is to be shown
+func redactContent(a slog.Attr, show bool) slog.Attr {
+	switch value := a.Value.Resolve(); value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactContent(member, show)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		text, ok := value.Any().(content)
+		if !ok {
+			return a
+		}
+		if show {
+			return slog.String(a.Key, string(text))
+		}
+		return slog.String(a.Key, fmt.Sprintf("%s (%d bytes)", REDACTED, len(text)))
+	default:
+		return a
+	}
+}
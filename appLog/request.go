@@ -0,0 +1,184 @@
+package appLog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// REQUEST_ID_HEADER carries the request ID, both from a caller such as a load balancer and back in the response
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// MAX_REQUEST_ID_LENGTH is the longest request ID accepted from a caller
+const MAX_REQUEST_ID_LENGTH = 64
+
+// fieldsKey is the context key of a request's log attributes.
+type fieldsKey struct{}
+
+// fields are the attributes logged with every record of a request. They are shared by the request's contexts,
+// so an attribute added by a handler, e.g. the user, is also logged by the middleware that started the request.
+type fields struct {
+	mu        sync.Mutex
+	requestID string
+	attrs     []slog.Attr
+}
+
+// WithRequestID starts the log attributes of a request, beginning with its ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{requestID: requestID, attrs: []slog.Attr{slog.String("requestId", requestID)}})
+}
+
+// RequestID returns the ID of the context's request, or "" outside a request
+func RequestID(ctx context.Context) string {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return ""
+	}
+	return f.requestID
+}
+
+// AddAttrs adds attributes to every later record of the context's request. Outside a request it does nothing.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attrs = append(f.attrs, attrs...)
+}
+
+// contextAttrs returns a copy of the attributes of the context's request
+func contextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// validRequestID checks that a caller's request ID is short and safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+	for _, c := range id {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlphanumeric && c != '-' && c != '_' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// Transport adds the request ID of each outgoing request's context to its X-Request-Id header,
+// and logs the request at debug level, so calls to e.g. the LLM can be matched to the API request that made them.
+type Transport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	if requestID := RequestID(ctx); requestID != "" {
+		// A RoundTripper must not modify the caller's request
+		req = req.Clone(ctx)
+		req.Header.Set(REQUEST_ID_HEADER, requestID)
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		slog.DebugContext(ctx, "Outgoing request failed", "method", req.Method, "host", req.URL.Host, "path", req.URL.Path,
+			"durationMs", time.Since(start).Milliseconds(), "error", err)
+		return nil, err
+	}
+	slog.DebugContext(ctx, "Outgoing request", "method", req.Method, "host", req.URL.Host, "path", req.URL.Path,
+		"status", resp.StatusCode, "durationMs", time.Since(start).Milliseconds())
+	return resp, nil
+}
+
+// Middleware gives each request an ID, taken from its X-Request-Id header if valid and otherwise new,
+// which is returned in the response's header and logged with every record of the request.
+// Each request is logged once it finishes, with its status and duration.
+// Successful requests to the quiet paths, such as health checks, are only logged at debug level.
+func Middleware(next http.Handler, quietPaths ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(REQUEST_ID_HEADER)
+		if !validRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestID)
+		ctx := WithRequestID(r.Context(), requestID)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", requestID))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if recorder.status < http.StatusBadRequest && slices.Contains(quietPaths, r.URL.Path) {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "Request", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"bytes", recorder.bytes, "durationMs", time.Since(start).Milliseconds())
+	})
+}
+
+// statusRecorder remembers the status and size of a response.
+// It can still be flushed, for Server-Sent Events, and unwrapped by http.ResponseController.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,168 @@
+package appMetrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NAMESPACE prefixes the names of all the server's metrics
+const NAMESPACE = "programming_agent"
+
+// Values of the outcome label
+const (
+	OUTCOME_OK    = "ok"
+	OUTCOME_ERROR = "error"
+)
+
+// Values of the decision label of the rate limits
+const (
+	DECISION_ALLOWED  = "allowed"
+	DECISION_REJECTED = "rejected"
+)
+
+// Metrics are registered with the default registry, so they are shared by every Server in the process,
+// and exported alongside the Go runtime and process metrics.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "API requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to respond to API requests, including whole chat turns.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 180},
+	}, []string{"route", "method", "code"})
+
+	modelDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Time taken by model calls, by model and outcome.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 45, 60},
+	}, []string{"model", "outcome"})
+
+	modelTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens used by model calls, by model and type (prompt or completion).",
+	}, []string{"model", "type"})
+
+	modelErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "llm_errors_total",
+		Help:      "Failed model calls, by model.",
+	}, []string{"model"})
+
+	toolCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "tool_calls_total",
+		Help:      "Tool calls made by the model, by tool and outcome.",
+	}, []string{"tool", "outcome"})
+
+	awsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "aws_request_duration_seconds",
+		Help:      "Time taken by AWS API calls, e.g. to S3 and DynamoDB, by service, operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation", "outcome"})
+
+	awsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "aws_errors_total",
+		Help:      "Failed AWS API calls, by service and operation.",
+	}, []string{"service", "operation"})
+
+	limitDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "rate_limit_decisions_total",
+		Help:      "Requests and model calls allowed or rejected by each limit, by limit and decision.",
+	}, []string{"limit", "decision"})
+
+	semaphoreSlots = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "semaphore_slots",
+		Help:      "Slots of each concurrency limit, e.g. of model calls, by limit and state (capacity, running or queued).",
+	}, []string{"limit", "state"})
+
+	semaphoreQueuedUsers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "semaphore_queued_users",
+		Help:      "Users with calls waiting for a slot of each concurrency limit.",
+	}, []string{"limit"})
+
+	previewStartDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "preview_start_duration_seconds",
+		Help:      "Time taken to start a user's Fargate preview task, by outcome.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"outcome"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentRoute counts the requests to a route and times them, by method and status code.
+// The route is the mux pattern rather than the path, so the number of series stays bounded.
+func InstrumentRoute(route string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	return promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels),
+		promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels), next))
+}
+
+// ObserveModelCall records the duration of a model call, and its tokens or its failure
+func ObserveModelCall(model string, duration time.Duration, promptTokens int, completionTokens int, err error) {
+	modelDuration.WithLabelValues(model, outcome(err)).Observe(duration.Seconds())
+	if err != nil {
+		modelErrors.WithLabelValues(model).Inc()
+		return
+	}
+	modelTokens.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	modelTokens.WithLabelValues(model, "completion").Add(float64(completionTokens))
+}
+
+// ObserveToolCall counts a tool call by whether it succeeded
+func ObserveToolCall(tool string, err error) {
+	toolCalls.WithLabelValues(tool, outcome(err)).Inc()
+}
+
+// ObserveAWSCall records the duration of an AWS API call, and its failure
+func ObserveAWSCall(service string, operation string, duration time.Duration, err error) {
+	awsDuration.WithLabelValues(service, operation, outcome(err)).Observe(duration.Seconds())
+	if err != nil {
+		awsErrors.WithLabelValues(service, operation).Inc()
+	}
+}
+
+// ObserveLimit counts a decision of a rate or concurrency limit, one of the DECISION_* values
+func ObserveLimit(limit string, decision string) {
+	limitDecisions.WithLabelValues(limit, decision).Inc()
+}
+
+// ObserveSemaphore records the current load of a concurrency limit
+func ObserveSemaphore(limit string, capacity int, running int, queued int, queuedUsers int) {
+	semaphoreSlots.WithLabelValues(limit, "capacity").Set(float64(capacity))
+	semaphoreSlots.WithLabelValues(limit, "running").Set(float64(running))
+	semaphoreSlots.WithLabelValues(limit, "queued").Set(float64(queued))
+	semaphoreQueuedUsers.WithLabelValues(limit).Set(float64(queuedUsers))
+}
+
+// ObservePreviewStart records the duration of starting a user's preview task
+func ObservePreviewStart(duration time.Duration, err error) {
+	previewStartDuration.WithLabelValues(outcome(err)).Observe(duration.Seconds())
+}
+
+// outcome labels whether an operation succeeded
+func outcome(err error) string {
+	if err != nil {
+		return OUTCOME_ERROR
+	}
+	return OUTCOME_OK
+}
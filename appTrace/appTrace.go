@@ -0,0 +1,140 @@
+package appTrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+)
+
+// TRACER_NAME is the instrumentation scope of the server's own spans
+const TRACER_NAME = "github.com/stephen1cowley/programming-agent-server"
+
+// Setup installs the global tracer provider configured by the trace settings, and the W3C trace context propagator,
+// so spans are continued from callers and passed on to the LLM. With the none exporter, spans are not recorded at all.
+// The returned function flushes the spans still buffered, and must be called before exiting.
+func Setup(ctx context.Context, settings appConfig.TraceConfig, environment string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch settings.Exporter {
+	case appConfig.TRACE_EXPORTER_NONE:
+		return func(context.Context) error { return nil }, nil
+	case appConfig.TRACE_EXPORTER_OTLP:
+		var options []otlptracehttp.Option
+		if settings.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(settings.Endpoint))
+		}
+		otlpExporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+		}
+		exporter = otlpExporter
+	case appConfig.TRACE_EXPORTER_FILE:
+		if err := os.MkdirAll(filepath.Dir(settings.File), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create the trace file's directory: %w", err)
+		}
+		var err error
+		file, err = os.OpenFile(settings.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create the file exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", settings.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", settings.ServiceName),
+		attribute.String("deployment.environment", environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span of the server's own work, such as a chat turn or a tool call, as a child of the context's span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if there was an error.
+// Only the error's class is recorded, as error messages may quote users' code or messages, which must not be sent out in traces.
+func End(span trace.Span, err error) {
+	if err != nil {
+		class := ErrorClass(err)
+		span.SetAttributes(attribute.String("error.type", class))
+		span.SetStatus(codes.Error, class)
+	}
+	span.End()
+}
+
+// ErrorClass names the kind of the error without giving its message: timeout or canceled if a context ended,
+// the code of an AWS API error, e.g. ThrottlingException, or otherwise the type of the innermost wrapped error,
+// e.g. *buildCheck.CompileError. Errors which are only text are classed as error.
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) && coded.ErrorCode() != "" {
+		return coded.ErrorCode()
+	}
+
+	for {
+		var next error
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			next = wrapped.Unwrap()
+		case interface{ Unwrap() []error }:
+			if errs := wrapped.Unwrap(); len(errs) != 0 {
+				next = errs[0]
+			}
+		}
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	class := fmt.Sprintf("%T", err)
+	if class == "*errors.errorString" {
+		return "error"
+	}
+	return class
+}
@@ -0,0 +1,66 @@
+package appTrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	buildCheck "github.com/stephen1cowley/programming-agent-server/buildCheck"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"text", errors.New(`the search text "<h1>secret</h1>" was not found`), "error"},
+		{"wrapped text", fmt.Errorf("edit 1: %w", errors.New("not found")), "error"},
+		{"typed", fmt.Errorf("write App.js: %w", &buildCheck.CompileError{}), "*buildCheck.CompileError"},
+		{"joined", errors.Join(&buildCheck.CompileError{}, errors.New("other")), "*buildCheck.CompileError"},
+		{"timeout", fmt.Errorf("ChatCompletion error: %w", context.DeadlineExceeded), "timeout"},
+		{"canceled", context.Canceled, "canceled"},
+		{"AWS API error", fmt.Errorf("operation error: %w", &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}), "ThrottlingException"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ErrorClass(test.err); got != test.want {
+				t.Errorf("ErrorClass() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndRecordsOnlyTheClass(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	_, span := provider.Tracer(TRACER_NAME).Start(context.Background(), "tool edit_file")
+
+	const secret = "const apiKey = 'sk-secret'"
+	End(span, fmt.Errorf("edit 1: the search text %q was not found", secret))
+
+	ended := recorder.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(ended))
+	}
+	got := ended[0]
+	if got.Status().Code != codes.Error || got.Status().Description != "error" {
+		t.Errorf("status = %+v, want an error described by its class", got.Status())
+	}
+	if len(got.Events()) != 0 {
+		t.Errorf("events = %+v, want no recorded exception", got.Events())
+	}
+	for _, attr := range got.Attributes() {
+		if strings.Contains(attr.Value.Emit(), "sk-secret") {
+			t.Errorf("attribute %s = %q quotes the error message", attr.Key, attr.Value.Emit())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Shortest time between fetches of a remote JWKS, so tokens with unknown key IDs cannot make us hammer the issuer
+const MIN_REFRESH_INTERVAL = time.Minute
+
+// ErrUnknownKey is returned by a KeySet which has no key with the given ID.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet finds the public keys tokens are signed with, by their key ID.
+type KeySet interface {
+	Key(kid string) (*rsa.PublicKey, error)
+}
+
+// jwk is a JSON Web Key. Only RSA keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwks is a JSON Web Key Set, as served at an issuer's /.well-known/jwks.json.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// parseJWKS returns the RSA signing keys of a JWKS by their key ID, ignoring keys of other types
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %s: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %s: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the JWKS has no RSA signing keys")
+	}
+	return keys, nil
+}
+
+// StaticKeySet is a fixed set of keys, e.g. loaded from a local file to test with self-signed tokens.
+type StaticKeySet map[string]*rsa.PublicKey
+
+// LoadKeySetFile reads a JWKS from a local file
+func LoadKeySetFile(path string) (StaticKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the JWKS file: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return StaticKeySet(keys), nil
+}
+
+func (s StaticKeySet) Key(kid string) (*rsa.PublicKey, error) {
+	key, exists := s[kid]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// RemoteKeySet fetches the keys from a JWKS URL, fetching them again when a token is signed with a new key.
+// The keys it has are found without waiting for a fetch, and concurrent requests for new keys share one fetch.
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+	group  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	lastFetch time.Time
+}
+
+// NewRemoteKeySet fetches the JWKS at the URL, so misconfiguration is found on startup
+func NewRemoteKeySet(url string) (*RemoteKeySet, error) {
+	s := &RemoteKeySet{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *RemoteKeySet) Key(kid string) (*rsa.PublicKey, error) {
+	if key, exists := s.key(kid); exists {
+		return key, nil
+	}
+	// The issuer may have rotated its keys
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	if key, exists := s.key(kid); exists {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// key returns the key with the ID, if it was in the last JWKS fetched
+func (s *RemoteKeySet) key(kid string) (*rsa.PublicKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, exists := s.keys[kid]
+	return key, exists
+}
+
+// refresh fetches the keys again, unless they were fetched within MIN_REFRESH_INTERVAL.
+// Callers arriving while a fetch is running wait for it rather than starting another.
+func (s *RemoteKeySet) refresh() error {
+	_, err, _ := s.group.Do(s.url, func() (any, error) {
+		s.mu.Lock()
+		recent := time.Since(s.lastFetch) < MIN_REFRESH_INTERVAL
+		s.mu.Unlock()
+		if recent {
+			return nil, nil
+		}
+		return nil, s.fetch()
+	})
+	return err
+}
+
+// fetch replaces the keys with those currently at the URL. s.mu is only held to update them, not during the request.
+func (s *RemoteKeySet) fetch() error {
+	s.mu.Lock()
+	s.lastFetch = time.Now()
+	s.mu.Unlock()
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch the JWKS: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read the JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the JWKS of the current key, counting the fetches.
+// While block is set, fetches wait until it is closed.
+type jwksServer struct {
+	t       *testing.T
+	mu      sync.Mutex
+	kid     string
+	key     *rsa.PrivateKey
+	block   chan struct{}
+	fetches atomic.Int32
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.fetches.Add(1)
+	s.mu.Lock()
+	kid, key, block := s.kid, s.key, s.block
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	data, err := MarshalJWKS(kid, key)
+	if err != nil {
+		s.t.Error(err)
+	}
+	w.Write(data)
+}
+
+// rotate replaces the served key, blocking fetches of the new one until the returned channel is closed
+func (s *jwksServer) rotate(kid string, key *rsa.PrivateKey) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kid, s.key, s.block = kid, key, make(chan struct{})
+	return s.block
+}
+
+// newTestRemoteKeySet serves a JWKS and creates a RemoteKeySet fetching it
+func newTestRemoteKeySet(t *testing.T) (*RemoteKeySet, *jwksServer, *rsa.PrivateKey) {
+	t.Helper()
+	key := newTestKey(t)
+	server := &jwksServer{t: t, kid: TEST_KID, key: key}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	keys, err := NewRemoteKeySet(ts.URL)
+	if err != nil {
+		t.Fatalf("NewRemoteKeySet() = %v", err)
+	}
+	return keys, server, key
+}
+
+func TestLoadKeySetFile(t *testing.T) {
+	key := newTestKey(t)
+	data, err := MarshalJWKS(TEST_KID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeySetFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeySetFile() = %v", err)
+	}
+	if got, err := keys.Key(TEST_KID); err != nil || !got.Equal(&key.PublicKey) {
+		t.Errorf("Key(%q) = %v, want the public key", TEST_KID, err)
+	}
+	if _, err := keys.Key("other"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key(other) = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not JSON", "{", "invalid JWKS"},
+		{"no keys", `{"keys": []}`, "the JWKS has no RSA signing keys"},
+		{"only an encryption key", `{"keys": [{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`, "the JWKS has no RSA signing keys"},
+		{"only an EC key", `{"keys": [{"kty": "EC", "kid": "ec"}]}`, "the JWKS has no RSA signing keys"},
+		{"bad modulus", `{"keys": [{"kty": "RSA", "kid": "bad", "n": "!!", "e": "AQAB"}]}`, "invalid modulus of key bad"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseJWKS([]byte(test.data)); err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+				t.Errorf("parseJWKS() = %v, want an error starting %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	keys, server, key := newTestRemoteKeySet(t)
+	if got, err := keys.Key(TEST_KID); err != nil || !got.Equal(&key.PublicKey) {
+		t.Fatalf("Key(%q) = %v, want the public key", TEST_KID, err)
+	}
+
+	// A key which is not known yet is only fetched again once MIN_REFRESH_INTERVAL has passed
+	newKey := newTestKey(t)
+	close(server.rotate("key2", newKey))
+	if _, err := keys.Key("key2"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key(key2) just after a fetch = %v, want %v", err, ErrUnknownKey)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+
+	keys.lastFetch = time.Now().Add(-MIN_REFRESH_INTERVAL)
+	if got, err := keys.Key("key2"); err != nil || !got.Equal(&newKey.PublicKey) {
+		t.Errorf("Key(key2) after the interval = %v, want the new public key", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+	// The old key was rotated out
+	if _, err := keys.Key(TEST_KID); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key(%q) after rotation = %v, want %v", TEST_KID, err, ErrUnknownKey)
+	}
+}
+
+func TestRemoteKeySetConcurrentFetch(t *testing.T) {
+	keys, server, _ := newTestRemoteKeySet(t)
+	newKey := newTestKey(t)
+	unblock := server.rotate("key2", newKey)
+	keys.lastFetch = time.Now().Add(-MIN_REFRESH_INTERVAL)
+
+	// Many requests with the new key arrive while the JWKS is being fetched
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := keys.Key("key2"); err != nil || !got.Equal(&newKey.PublicKey) {
+				t.Errorf("Key(key2) = %v, want the new public key", err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for server.fetches.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Keys already fetched are found without waiting for the fetch
+	found := make(chan error, 1)
+	go func() {
+		_, err := keys.Key(TEST_KID)
+		found <- err
+	}()
+	select {
+	case err := <-found:
+		if err != nil {
+			t.Errorf("Key(%q) during a fetch = %v, want the old public key", TEST_KID, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Key(%q) waited for the fetch of another key", TEST_KID)
+	}
+
+	close(unblock)
+	wg.Wait()
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetched %d times for %d concurrent callers, want 2 (one on startup and one shared)", got, callers)
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Allowed difference between our clock and the issuer's
+const CLOCK_LEEWAY = time.Minute
+
+// Claims which name the user, tried in order: Cognito ID tokens have cognito:username, and access tokens username
+var DefaultUserClaims = []string{"cognito:username", "username", "sub"}
+
+// ErrInvalidToken is wrapped by every error returned for a token which is not accepted.
+var ErrInvalidToken = errors.New("invalid token")
+
+// header is the header of a JWT.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verifier checks the signature and registered claims of JWTs from a single issuer.
+type Verifier struct {
+	Issuer   string
+	Audience string // the app client ID, matched against aud, or client_id in Cognito access tokens
+	Keys     KeySet
+	// UserClaims are the claims tried in order for the user ID
+	UserClaims []string
+	// TokenUse is the token_use claim tokens must have, e.g. "access" so that Cognito ID tokens are not accepted, or empty for any
+	TokenUse string
+}
+
+// NewVerifier accepts tokens from the issuer for the audience, signed by one of the keys
+func NewVerifier(issuer string, audience string, keys KeySet) *Verifier {
+	return &Verifier{Issuer: issuer, Audience: audience, Keys: keys, UserClaims: DefaultUserClaims}
+}
+
+// Verify checks the token's RS256 signature, issuer, audience, token use, expiry and not-before time,
+// and returns the ID of the user it was issued to
+func (v *Verifier) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: it is not a JWT", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return "", fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+	// Only accept the algorithm the keys are for, so "none" or HMAC with the public key cannot be used
+	if h.Alg != "RS256" {
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+	}
+	key, err := v.Keys.Key(h.Kid)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	for _, name := range v.UserClaims {
+		if userID, ok := claims[name].(string); ok && userID != "" {
+			return userID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: it has none of the claims %s", ErrInvalidToken, strings.Join(v.UserClaims, ", "))
+}
+
+// checkClaims checks the registered claims against the verifier's issuer and audience, and the time
+func (v *Verifier) checkClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return fmt.Errorf("issued by %q rather than %q", iss, v.Issuer)
+	}
+	if !slices.Contains(audiences(claims), v.Audience) {
+		return fmt.Errorf("not issued for %q", v.Audience)
+	}
+	if use, _ := claims["token_use"].(string); v.TokenUse != "" && use != v.TokenUse {
+		return fmt.Errorf("it is for %q rather than %q", use, v.TokenUse)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("it has no expiry")
+	}
+	if now.Add(-CLOCK_LEEWAY).After(time.Unix(int64(exp), 0)) {
+		return errors.New("it has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(CLOCK_LEEWAY).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("it is not valid yet")
+	}
+	return nil
+}
+
+// audiences returns the aud claim, which may be a string or a list, along with Cognito's client_id
+func audiences(claims map[string]any) []string {
+	var result []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		result = append(result, aud)
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+	if clientID, ok := claims["client_id"].(string); ok {
+		result = append(result, clientID)
+	}
+	return result
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_ISSUER   = "https://cognito-idp.eu-west-2.amazonaws.com/eu-west-2_test"
+	TEST_AUDIENCE = "client123"
+	TEST_KID      = "key1"
+)
+
+// newTestKey creates an RSA key to sign test tokens with
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// encodeToken creates a token with the header and claims, and the signature already encoded
+func encodeToken(t *testing.T, h header, claims map[string]any, signature string) string {
+	t.Helper()
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON) + "." + signature
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+	verifier := NewVerifier(TEST_ISSUER, TEST_AUDIENCE, StaticKeySet{TEST_KID: &key.PublicKey})
+	verifier.TokenUse = "access"
+
+	now := time.Now()
+	// valid are the claims of a Cognito access token
+	valid := map[string]any{
+		"iss":       TEST_ISSUER,
+		"client_id": TEST_AUDIENCE,
+		"token_use": "access",
+		"sub":       "0b8f-sub",
+		"username":  "alice",
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+	}
+	// with returns the valid claims with some changed, or removed if they are set to nil
+	with := func(changes map[string]any) map[string]any {
+		claims := maps.Clone(valid)
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	sign := func(claims map[string]any, kid string, key *rsa.PrivateKey) string {
+		token, err := Sign(claims, kid, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	validToken := sign(valid, TEST_KID, key)
+	parts := strings.Split(validToken, ".")
+
+	// The public key, which an attacker knows, used as an HMAC secret
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := encodeToken(t, header{Alg: "HS256", Kid: TEST_KID}, valid, "")
+	mac := hmac.New(sha256.New, publicDER)
+	mac.Write([]byte(strings.TrimSuffix(hs256, ".")))
+	hs256 += base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr string // part of the error, if the token is rejected
+	}{
+		{name: "access token", token: validToken, want: "alice"},
+		{name: "aud rather than client_id", token: sign(with(map[string]any{"client_id": nil, "aud": TEST_AUDIENCE}), TEST_KID, key), want: "alice"},
+		{name: "one of several audiences", token: sign(with(map[string]any{"client_id": nil, "aud": []string{"other", TEST_AUDIENCE}}), TEST_KID, key), want: "alice"},
+		{name: "cognito:username first", token: sign(with(map[string]any{"cognito:username": "bob"}), TEST_KID, key), want: "bob"},
+		{name: "sub last", token: sign(with(map[string]any{"username": nil}), TEST_KID, key), want: "0b8f-sub"},
+		{name: "expired within the leeway", token: sign(with(map[string]any{"exp": now.Add(-CLOCK_LEEWAY / 2).Unix()}), TEST_KID, key), want: "alice"},
+
+		{name: "expired", token: sign(with(map[string]any{"exp": now.Add(-2 * CLOCK_LEEWAY).Unix()}), TEST_KID, key), wantErr: "it has expired"},
+		{name: "no expiry", token: sign(with(map[string]any{"exp": nil}), TEST_KID, key), wantErr: "it has no expiry"},
+		{name: "not valid yet", token: sign(with(map[string]any{"nbf": now.Add(2 * CLOCK_LEEWAY).Unix()}), TEST_KID, key), wantErr: "it is not valid yet"},
+		{name: "wrong issuer", token: sign(with(map[string]any{"iss": "https://evil.example.com"}), TEST_KID, key), wantErr: `issued by "https://evil.example.com"`},
+		{name: "no issuer", token: sign(with(map[string]any{"iss": nil}), TEST_KID, key), wantErr: `issued by ""`},
+		{name: "wrong audience", token: sign(with(map[string]any{"client_id": "other"}), TEST_KID, key), wantErr: `not issued for "client123"`},
+		{name: "ID token", token: sign(with(map[string]any{"client_id": nil, "aud": TEST_AUDIENCE, "token_use": "id"}), TEST_KID, key), wantErr: `it is for "id" rather than "access"`},
+		{name: "no token use", token: sign(with(map[string]any{"token_use": nil}), TEST_KID, key), wantErr: `it is for "" rather than "access"`},
+		{name: "no user", token: sign(with(map[string]any{"username": nil, "sub": nil}), TEST_KID, key), wantErr: "it has none of the claims"},
+
+		{name: "signed by another key", token: sign(valid, TEST_KID, otherKey), wantErr: "bad signature"},
+		{name: "unknown key", token: sign(valid, "key2", key), wantErr: ErrUnknownKey.Error()},
+		{name: "claims changed after signing", token: encodeToken(t, header{Alg: "RS256", Kid: TEST_KID}, with(map[string]any{"username": "bob"}), parts[2]), wantErr: "bad signature"},
+		{name: "alg none", token: encodeToken(t, header{Alg: "none", Kid: TEST_KID}, valid, ""), wantErr: `unsupported algorithm "none"`},
+		{name: "alg HS256 with the public key", token: hs256, wantErr: `unsupported algorithm "HS256"`},
+		{name: "not a JWT", token: "not-a-token", wantErr: "it is not a JWT"},
+		{name: "bad signature encoding", token: parts[0] + "." + parts[1] + ".!!!", wantErr: "bad signature encoding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := verifier.Verify(test.token)
+			if test.wantErr != "" {
+				if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Verify() = %q, %v, want an invalid token error containing %q", got, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("Verify() = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAnyTokenUse(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(TEST_ISSUER, TEST_AUDIENCE, StaticKeySet{TEST_KID: &key.PublicKey})
+
+	for _, use := range []string{"access", "id", ""} {
+		claims := map[string]any{"iss": TEST_ISSUER, "aud": TEST_AUDIENCE, "sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+		if use != "" {
+			claims["token_use"] = use
+		}
+		token, err := Sign(claims, TEST_KID, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := verifier.Verify(token); err != nil || got != "alice" {
+			t.Errorf("Verify() of a token for %q = %q, %v, want alice when any token use is accepted", use, got, err)
+		}
+	}
+}
@@ -8,34 +8,44 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/sashabaranov/go-openai"
 
-	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	userStore "github.com/stephen1cowley/programming-agent-server/userStore"
 )
 
-const (
-	DYNAMO_DB_TABLE = "programming-agent-users"
-)
+// DynamoUserStore is a userStore.UserStore backed by a DynamoDB table keyed on UserID.
+type DynamoUserStore struct {
+	client *dynamodb.Client
+	table  string
+}
 
-// UserState holds the current state for a given user.
-// This includes the current back-and-forth with the AI,
-// as well as the current Directory state.
-type UserState struct {
-	UserID         string                         `json:"UserID"`
-	Messages       []openai.ChatCompletionMessage `json:"Messages"`
-	DirectoryState funcTools.DirectoryState       `json:"DirectoryState"`
-	FargateTaskARN string                         `json:"FargateTaskARN"`
+// NewDynamoUserStore creates a fresh dynamodb client for the given table
+func NewDynamoUserStore(cfg aws.Config, table string) *DynamoUserStore {
+	return &DynamoUserStore{
+		client: dynamodb.NewFromConfig(cfg),
+		table:  table,
+	}
 }
 
-var dynamoClient *dynamodb.Client
+// PING_USER_ID is the key read by Ping, which no real user has
+const PING_USER_ID = "__ping__"
 
-// InitDynamo creates a fresh global dynamodb client
-func InitDynamo(cfg aws.Config) {
-	dynamoClient = dynamodb.NewFromConfig(cfg)
+// Ping checks the table can be read, with the same permission as GetUser
+func (d *DynamoUserStore) Ping(ctx context.Context) error {
+	_, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: PING_USER_ID},
+		},
+		ProjectionExpression: aws.String("UserID"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read table %s: %w", d.table, err)
+	}
+	return nil
 }
 
-// DynamoPutUser creates a new user with the given details
-func DynamoPutUser(user UserState) error {
+// PutUser creates a new user with the given details, replacing any existing one
+func (d *DynamoUserStore) PutUser(ctx context.Context, user userStore.UserState) error {
 	// Marshal the user struct to a DynamoDB attribute value
 	av, err := attributevalue.MarshalMap(user)
 	if err != nil {
@@ -44,12 +54,12 @@ func DynamoPutUser(user UserState) error {
 
 	// Create the input for PutItem
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String(DYNAMO_DB_TABLE),
+		TableName: aws.String(d.table),
 		Item:      av,
 	}
 
 	// Put the item into the Users table
-	_, err = dynamoClient.PutItem(context.TODO(), input)
+	_, err = d.client.PutItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to put item: %w", err)
 	}
@@ -57,29 +67,29 @@ func DynamoPutUser(user UserState) error {
 	return nil
 }
 
-// DynamoGetUser retrieves a user's information from the DynamoDB table based on the UserID
-func DynamoGetUser(userID string) (*UserState, error) {
+// GetUser retrieves a user's information from the DynamoDB table based on the UserID
+func (d *DynamoUserStore) GetUser(ctx context.Context, userID string) (*userStore.UserState, error) {
 	// Create the input for GetItem
 	input := &dynamodb.GetItemInput{
-		TableName: aws.String(DYNAMO_DB_TABLE),
+		TableName: aws.String(d.table),
 		Key: map[string]types.AttributeValue{
 			"UserID": &types.AttributeValueMemberS{Value: userID}, // Assuming UserID is the primary key
 		},
 	}
 
 	// Get the item from the table
-	result, err := dynamoClient.GetItem(context.TODO(), input)
+	result, err := d.client.GetItem(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get item: %w", err)
 	}
 
 	// Check if the item exists
 	if result.Item == nil {
-		return nil, fmt.Errorf("user with ID %s not found", userID)
+		return nil, fmt.Errorf("user with ID %s: %w", userID, userStore.ErrUserNotFound)
 	}
 
 	// Unmarshal the result into a User struct
-	var user UserState
+	var user userStore.UserState
 	err = attributevalue.UnmarshalMap(result.Item, &user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
@@ -87,3 +97,44 @@ func DynamoGetUser(userID string) (*UserState, error) {
 
 	return &user, nil
 }
+
+// DeleteUser removes a user's item from the DynamoDB table
+func (d *DynamoUserStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete item: %w", err)
+	}
+
+	return nil
+}
+
+// ListUsers scans the DynamoDB table and returns every UserID in it
+func (d *DynamoUserStore) ListUsers(ctx context.Context) ([]string, error) {
+	var userIDs []string
+
+	// Only project the key, as full items can be large
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName:            aws.String(d.table),
+		ProjectionExpression: aws.String("UserID"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		for _, item := range page.Items {
+			var key struct{ UserID string }
+			if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal user ID: %w", err)
+			}
+			userIDs = append(userIDs, key.UserID)
+		}
+	}
+
+	return userIDs, nil
+}
@@ -4,18 +4,20 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"os"
+	"log/slog"
 	"os/exec"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// getECRLogin ensures the aws config directory is correctly set up with a token
-func getECRLogin(cfg aws.Config) error {
+// getECRLogin ensures the aws config directory is correctly set up with a token for the registry
+func getECRLogin(ctx context.Context, cfg aws.Config, myRegistry string) error {
 	client := ecr.NewFromConfig(cfg)
-	result, err := client.GetAuthorizationToken(context.TODO(), &ecr.GetAuthorizationTokenInput{})
+	result, err := client.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
 	if err != nil {
 		return err
 	}
@@ -29,55 +31,49 @@ func getECRLogin(cfg aws.Config) error {
 	credentials := strings.Split(string(decodedToken), ":")
 	registry := *authData.ProxyEndpoint
 
-	myRegistry := "211125355525.dkr.ecr.eu-west-2.amazonaws.com"
-
-	cmd := exec.Command("sudo", "docker", "login", "--username", credentials[0], "--password", credentials[1], myRegistry)
+	cmd := exec.CommandContext(ctx, "sudo", "docker", "login", "--username", credentials[0], "--password", credentials[1], myRegistry)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("docker login failed: %v\noutput: %s", err, string(output))
 	}
 
-	fmt.Printf("Docker login successful for registry: %s\n", registry)
+	slog.InfoContext(ctx, "Docker login successful", "registry", registry)
 	return nil
 }
 
-// buildDockerImage builds the image in the "/home/ubuntu/user-react-app" directory
-func buildDockerImage(imageName string) error {
-	err := os.Chdir("/home/ubuntu/user-react-app")
-	if err != nil {
-		fmt.Println("Error changing directory:", err)
-		return err
-	}
-	cmd := exec.Command("sudo", "docker", "build", "-t", imageName, ".")
+// buildDockerImage builds the image in the app's directory
+func buildDockerImage(ctx context.Context, imageName, appDir string) (err error) {
+	ctx, span := appTrace.Start(ctx, "docker build", attribute.String("container.image.name", imageName))
+	defer func() { appTrace.End(span, err) }()
+
+	cmd := exec.CommandContext(ctx, "sudo", "docker", "build", "-t", imageName, ".")
+	cmd.Dir = appDir
 
 	// Capture the combined stdout and stderr output
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		fmt.Printf("Error executing docker build: %v\n", err)
-		fmt.Printf("Docker build output: %s\n", string(output)) // Output error details
-		return err
+		return fmt.Errorf("docker build failed: %w\noutput: %s", err, string(output))
 	}
 
-	fmt.Printf("Docker build output: %s\n", string(output))
+	slog.DebugContext(ctx, "Docker build finished", "image", imageName, "output", string(output))
 	return nil
 }
 
 // pushDockerImage pushes a docker image to Amazon ECR
-func pushDockerImage(imageName, ecrRepo string) error {
-	tagCmd := exec.Command("sudo", "docker", "tag", imageName, ecrRepo)
+func pushDockerImage(ctx context.Context, imageName, ecrRepo string) (err error) {
+	ctx, span := appTrace.Start(ctx, "docker push", attribute.String("container.image.name", ecrRepo))
+	defer func() { appTrace.End(span, err) }()
+
+	tagCmd := exec.CommandContext(ctx, "sudo", "docker", "tag", imageName, ecrRepo)
 	output, err := tagCmd.CombinedOutput()
 	if err != nil {
-		fmt.Printf("Error executing docker tag: %v\n", err)
-		fmt.Printf("Docker tag output: %s\n", string(output)) // Output error details
-		return err
+		return fmt.Errorf("docker tag failed: %w\noutput: %s", err, string(output))
 	}
-	pushCmd := exec.Command("sudo", "docker", "push", ecrRepo)
+	pushCmd := exec.CommandContext(ctx, "sudo", "docker", "push", ecrRepo)
 	output, err = pushCmd.CombinedOutput()
 	if err != nil {
-		fmt.Printf("Error executing docker push: %v\n", err)
-		fmt.Printf("Docker push output: %s\n", string(output)) // Output error details
-		return err
+		return fmt.Errorf("docker push failed: %w\noutput: %s", err, string(output))
 	}
 	return nil
 }
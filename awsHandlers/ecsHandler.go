@@ -2,15 +2,46 @@ package awsHandlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	previewTask "github.com/stephen1cowley/programming-agent-server/previewTask"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// MAX_STARTED_BY_LENGTH is the longest startedBy ECS accepts for a task
+const MAX_STARTED_BY_LENGTH = 128
+
+// MAX_DESCRIBED_TASKS is the most tasks ECS describes in one call
+const MAX_DESCRIBED_TASKS = 100
+
+// STARTED_BY_PREFIX is the start of the startedBy of every preview task, followed by the user's ID
+const STARTED_BY_PREFIX = "preview-"
+
+// Deployment is where the React app's image is built and pushed, and its Fargate tasks run.
+// The image and its task definition, both named ImageName, are shared by every user's preview task.
+type Deployment struct {
+	AppDir           string // directory of the image's Dockerfile
+	ImageName        string
+	Registry         string // address of the ECR registry
+	Image            string // address of the image in the registry
+	Cluster          string
+	Subnets          []string
+	SecurityGroups   []string
+	ExecutionRoleARN string
+}
+
 // registerTaskDefinition registers an ECS task definition for Fargate using the provided ECR image
-func registerTaskDefinition(cfg aws.Config, taskDefinitionName, ecrImage string) (*ecs.RegisterTaskDefinitionOutput, error) {
+func registerTaskDefinition(ctx context.Context, cfg aws.Config, taskDefinitionName, ecrImage, executionRoleARN string) (*ecs.RegisterTaskDefinitionOutput, error) {
 	client := ecs.NewFromConfig(cfg)
 
 	input := &ecs.RegisterTaskDefinitionInput{
@@ -34,78 +65,235 @@ func registerTaskDefinition(cfg aws.Config, taskDefinitionName, ecrImage string)
 		RequiresCompatibilities: []ecstypes.Compatibility{ecstypes.CompatibilityFargate},
 		Cpu:                     aws.String("512"),
 		Memory:                  aws.String("2048"),
-		ExecutionRoleArn:        aws.String("arn:aws:iam::211125355525:role/MyFargateExecutionRole"),
+		ExecutionRoleArn:        aws.String(executionRoleARN),
 	}
 
-	return client.RegisterTaskDefinition(context.TODO(), input)
+	return client.RegisterTaskDefinition(ctx, input)
 }
 
-// runFargateTask runs a particular AWS Fargate task
-func runFargateTask(cfg aws.Config, clusterName, taskDefinitionName, subnetID, securityGroupID string) (*ecs.RunTaskOutput, error) {
-	client := ecs.NewFromConfig(cfg)
+// PublishPreviewImage builds and pushes a docker image to AWS ECR, and then registers the Fargate task definition
+// the users' preview tasks are run from, returning its ARN. Tasks started afterwards run the new image.
+func PublishPreviewImage(ctx context.Context, cfg aws.Config, d Deployment) (taskDefinitionARN string, output error) {
+	ctx, span := appTrace.Start(ctx, "publish preview image", attribute.String("container.image.name", d.ImageName))
+	defer func() { appTrace.End(span, output) }()
+
+	err := getECRLogin(ctx, cfg, d.Registry)
+	if err != nil {
+		return "", err
+	}
+
+	// Build, push, and register
+	if err := buildDockerImage(ctx, d.ImageName, d.AppDir); err != nil {
+		return "", err
+	}
+
+	if err := pushDockerImage(ctx, d.ImageName, d.Image); err != nil {
+		return "", err
+	}
+
+	registered, err := registerTaskDefinition(ctx, cfg, d.ImageName, d.Image, d.ExecutionRoleARN)
+	if err != nil {
+		return "", err
+	}
+
+	taskDefinitionARN = aws.ToString(registered.TaskDefinition.TaskDefinitionArn)
+	slog.InfoContext(ctx, "Registered the preview task definition", "taskDefinitionArn", taskDefinitionARN)
+	return taskDefinitionARN, nil
+}
+
+// ECSLauncher is a previewTask.Launcher running each user's preview as a Fargate task
+// of the latest revision of the Deployment's task definition.
+// The public addresses of the tasks are looked up in EC2, from their network interfaces.
+type ECSLauncher struct {
+	client    *ecs.Client
+	ec2Client *ec2.Client
+	d         Deployment
+}
+
+// NewECSLauncher creates fresh ECS and EC2 clients for the Deployment's cluster
+func NewECSLauncher(cfg aws.Config, d Deployment) *ECSLauncher {
+	return &ECSLauncher{client: ecs.NewFromConfig(cfg), ec2Client: ec2.NewFromConfig(cfg), d: d}
+}
+
+// Ping checks the cluster exists and is active
+func (l *ECSLauncher) Ping(ctx context.Context) error {
+	output, err := l.client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: []string{l.d.Cluster}})
+	if err != nil {
+		return fmt.Errorf("failed to describe cluster %s: %w", l.d.Cluster, err)
+	}
+	if len(output.Clusters) == 0 || aws.ToString(output.Clusters[0].Status) != "ACTIVE" {
+		return fmt.Errorf("cluster %s is not active", l.d.Cluster)
+	}
+	return nil
+}
+
+// Start runs a Fargate task for the user, passing the environment variables to its container.
+// The task is started by "preview-<userID>", so a user's tasks can be found in the ECS console and by List.
+// User IDs too long for ECS to record are rejected.
+func (l *ECSLauncher) Start(ctx context.Context, userID string, env map[string]string) (taskARN string, err error) {
+	ctx, span := appTrace.Start(ctx, "start preview task", attribute.String("ecs.cluster", l.d.Cluster))
+	defer func() { appTrace.End(span, err) }()
+
+	environment := make([]ecstypes.KeyValuePair, 0, len(env))
+	for name, value := range env {
+		environment = append(environment, ecstypes.KeyValuePair{Name: aws.String(name), Value: aws.String(value)})
+	}
+	sort.Slice(environment, func(i, j int) bool { return *environment[i].Name < *environment[j].Name })
 
-	input := &ecs.RunTaskInput{
-		Cluster:        aws.String(clusterName),
-		TaskDefinition: aws.String(taskDefinitionName),
+	// The user's ID is read back from startedBy to find who the task belongs to, so it cannot be shortened to fit
+	startedBy := STARTED_BY_PREFIX + userID
+	if len(startedBy) > MAX_STARTED_BY_LENGTH {
+		return "", fmt.Errorf("failed to run the preview task: the user ID is longer than %d characters", MAX_STARTED_BY_LENGTH-len(STARTED_BY_PREFIX))
+	}
+
+	output, err := l.client.RunTask(ctx, &ecs.RunTaskInput{
+		Cluster:        aws.String(l.d.Cluster),
+		TaskDefinition: aws.String(l.d.ImageName),
 		LaunchType:     ecstypes.LaunchTypeFargate,
+		StartedBy:      aws.String(startedBy),
 		NetworkConfiguration: &ecstypes.NetworkConfiguration{
 			AwsvpcConfiguration: &ecstypes.AwsVpcConfiguration{
-				Subnets:        []string{subnetID},
-				SecurityGroups: []string{securityGroupID},
+				Subnets:        l.d.Subnets,
+				SecurityGroups: l.d.SecurityGroups,
 				AssignPublicIp: ecstypes.AssignPublicIpEnabled,
 			},
 		},
+		Overrides: &ecstypes.TaskOverride{
+			ContainerOverrides: []ecstypes.ContainerOverride{
+				{Name: aws.String(l.d.ImageName), Environment: environment},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to run the preview task: %w", err)
+	}
+	// ECS reports tasks it could not place, e.g. for lack of capacity, as failures rather than an error
+	if len(output.Tasks) == 0 {
+		reason := "no task was started"
+		if len(output.Failures) != 0 {
+			reason = aws.ToString(output.Failures[0].Reason)
+		}
+		return "", fmt.Errorf("failed to run the preview task: %s", reason)
 	}
 
-	return client.RunTask(context.TODO(), input)
+	taskARN = aws.ToString(output.Tasks[0].TaskArn)
+	span.SetAttributes(attribute.String("aws.ecs.task.arn", taskARN))
+	slog.InfoContext(ctx, "Started the preview task", "taskArn", taskARN)
+	return taskARN, nil
 }
 
-// DeployReactApp builds and pushes a docker image to AWS ECR, and then registers and runs a Fargate task to run the image.
-func DeployReactApp(cfg aws.Config) (newArn string, output error) {
-	imageName := "programming-agent-ui"
-	ecrRepo := "211125355525.dkr.ecr.eu-west-2.amazonaws.com/programming-agent-ui:latest"
-	clusterName := "ProjectCluster2"
-	subnetID := "subnet-05b3b838935e29eeb"
-	securityGroupID := "sg-07d875c0a076ceeba"
+// Stop stops a particular ECS task that is currently running.
+func (l *ECSLauncher) Stop(ctx context.Context, taskARN string, reason string) error {
+	_, err := l.client.StopTask(ctx, &ecs.StopTaskInput{
+		Cluster: aws.String(l.d.Cluster),
+		Task:    aws.String(taskARN),
+		Reason:  aws.String(reason),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop task %s: %w", taskARN, err)
+	}
+	return nil
+}
 
-	err := getECRLogin(cfg)
+// Describe returns the status of the task, and its public address once it has one. ECS forgets tasks about an hour after they stop.
+func (l *ECSLauncher) Describe(ctx context.Context, taskARN string) (*previewTask.Task, error) {
+	tasks, err := l.describe(ctx, []string{taskARN})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("task %s: %w", taskARN, previewTask.ErrTaskNotFound)
 	}
 
-	// Build, push, and deploy
-	if err := buildDockerImage(imageName); err != nil {
-		return "", err
+	described := tasks[0]
+	task := newTask(described)
+	// The address is that of the task's network interface, once it has been attached
+	for _, attachment := range described.Attachments {
+		for _, detail := range attachment.Details {
+			if aws.ToString(detail.Name) == "networkInterfaceId" {
+				task.PublicIP, err = l.publicIP(ctx, aws.ToString(detail.Value))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
+	return task, nil
+}
 
-	if err := pushDockerImage(imageName, ecrRepo); err != nil {
-		return "", err
+// List returns the preview tasks in the cluster which have not been told to stop
+func (l *ECSLauncher) List(ctx context.Context) ([]previewTask.Task, error) {
+	var taskARNs []string
+	paginator := ecs.NewListTasksPaginator(l.client, &ecs.ListTasksInput{
+		Cluster:       aws.String(l.d.Cluster),
+		DesiredStatus: ecstypes.DesiredStatusRunning,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tasks of cluster %s: %w", l.d.Cluster, err)
+		}
+		taskARNs = append(taskARNs, page.TaskArns...)
 	}
 
-	_, err = registerTaskDefinition(cfg, imageName, ecrRepo)
-	if err != nil {
-		return "", err
+	var tasks []previewTask.Task
+	for start := 0; start < len(taskARNs); start += MAX_DESCRIBED_TASKS {
+		described, err := l.describe(ctx, taskARNs[start:min(start+MAX_DESCRIBED_TASKS, len(taskARNs))])
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range described {
+			// Other tasks may run in the cluster
+			if strings.HasPrefix(aws.ToString(task.StartedBy), STARTED_BY_PREFIX) {
+				tasks = append(tasks, *newTask(task))
+			}
+		}
 	}
+	return tasks, nil
+}
 
-	taskOutput, err := runFargateTask(cfg, clusterName, imageName, subnetID, securityGroupID)
+// describe describes up to MAX_DESCRIBED_TASKS tasks in the cluster, leaving out those ECS has forgotten
+func (l *ECSLauncher) describe(ctx context.Context, taskARNs []string) ([]ecstypes.Task, error) {
+	output, err := l.client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(l.d.Cluster),
+		Tasks:   taskARNs,
+	})
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to describe tasks %s: %w", strings.Join(taskARNs, ", "), err)
 	}
+	return output.Tasks, nil
+}
 
-	taskARN := *taskOutput.Tasks[0].TaskArn
-
-	fmt.Println(taskARN)
-
-	return taskARN, nil
-
+// newTask converts an ECS task to a preview task, without its address
+func newTask(described ecstypes.Task) *previewTask.Task {
+	return &previewTask.Task{
+		ARN:           aws.ToString(described.TaskArn),
+		UserID:        strings.TrimPrefix(aws.ToString(described.StartedBy), STARTED_BY_PREFIX),
+		Status:        aws.ToString(described.LastStatus),
+		DesiredStatus: aws.ToString(described.DesiredStatus),
+		CreatedAt:     aws.ToTime(described.CreatedAt),
+		StartedAt:     described.StartedAt,
+		StoppedReason: aws.ToString(described.StoppedReason),
+	}
 }
 
-// StopPreviousTask stops a particular ECS task that is currently running.
-func StopPreviousTask(cfg aws.Config, cluster string, taskArn string) error {
-	client := ecs.NewFromConfig(cfg)
-	_, err := client.StopTask(context.TODO(), &ecs.StopTaskInput{
-		Cluster: aws.String(cluster),
-		Task:    aws.String(taskArn),
+// publicIP returns the public address of the network interface, or "" if it has none, e.g. once the task has stopped
+func (l *ECSLauncher) publicIP(ctx context.Context, networkInterfaceID string) (string, error) {
+	output, err := l.ec2Client.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []string{networkInterfaceID},
 	})
-	return err
+	if err != nil {
+		// The interface is deleted soon after the task stops
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidNetworkInterfaceID.NotFound" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to describe network interface %s: %w", networkInterfaceID, err)
+	}
+	for _, networkInterface := range output.NetworkInterfaces {
+		if networkInterface.Association != nil {
+			return aws.ToString(networkInterface.Association.PublicIp), nil
+		}
+	}
+	return "", nil
 }
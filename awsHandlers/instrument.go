@@ -0,0 +1,50 @@
+package awsHandlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	awsMiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+	appTrace "github.com/stephen1cowley/programming-agent-server/appTrace"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// InstrumentAPICalls times every AWS API call and counts its errors, by service and operation.
+// Each call, including its retries, is a span named after its service and operation, e.g. "DynamoDB.GetItem".
+// It is also logged at debug level, with the request ID of its context and the AWS request ID,
+// so an API request can be traced to the AWS calls it made. Add it with config.WithAPIOptions.
+func InstrumentAPICalls(stack *middleware.Stack) error {
+	// After the operation's own middleware, which records its service and operation in the context
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InstrumentAPICalls", instrumentAPICall), middleware.After)
+}
+
+// instrumentAPICall runs a single AWS API call, recording its outcome
+func instrumentAPICall(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service, operation := awsMiddleware.GetServiceID(ctx), awsMiddleware.GetOperationName(ctx)
+	ctx, span := appTrace.Start(ctx, service+"."+operation, attribute.String("rpc.system", "aws-api"),
+		attribute.String("rpc.service", service), attribute.String("rpc.method", operation))
+
+	start := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	duration := time.Since(start)
+
+	appMetrics.ObserveAWSCall(service, operation, duration, err)
+
+	awsRequestID, _ := awsMiddleware.GetRequestIDMetadata(metadata)
+	span.SetAttributes(attribute.String("aws.request_id", awsRequestID))
+	appTrace.End(span, err)
+	attrs := []any{
+		"service", service,
+		"operation", operation,
+		"awsRequestId", awsRequestID,
+		"durationMs", duration.Milliseconds(),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	slog.DebugContext(ctx, "AWS call", attrs...)
+	return out, metadata, err
+}
@@ -3,163 +3,116 @@ package awsHandlers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"mime/multipart"
-	"net/http"
-	"path/filepath"
+	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-)
-
-var s3Client *s3.Client
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 
-// Hard-coded S3 names
-const (
-	S3_REGION     = "eu-west-2"
-	S3_BUCKET     = "my-programming-agent-img-store"
-	S3_BUCKET_APP = "test-stack-bucket-program-agent"
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
 )
 
-// InitS3 Creates a fresh S3 client, required for the running of the other S3 functions
-func InitS3(cfg aws.Config) {
-	s3Client = s3.NewFromConfig(cfg)
+// S3BlobStore is a blobStore.BlobStore backed by a single S3 bucket.
+type S3BlobStore struct {
+	client *s3.Client
+	bucket string
+	region string
 }
 
-// UploadToS3 uploads the file to S3 and returns the file URL
-func UploadToS3(file multipart.File, handler *multipart.FileHeader, userID string) (string, error) {
-	// Read file content
-	size := handler.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
-
-	// Prepare the file for upload
-	fileBytes := bytes.NewReader(buffer)
-	fileType := http.DetectContentType(buffer)
-	fileName := filepath.Base(handler.Filename)
-	s3Path := "uploads/" + userID + "/" + fileName
-
-	// Upload the file to S3
-	_, err := s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:        aws.String(S3_BUCKET),
-		Key:           aws.String(s3Path),
-		Body:          fileBytes,
-		ContentLength: &size,
-		ContentType:   aws.String(fileType),
-	})
-
-	if err != nil {
-		return "", err
+// NewS3BlobStore creates a fresh S3 client for the given bucket
+func NewS3BlobStore(cfg aws.Config, bucket string) *S3BlobStore {
+	return &S3BlobStore{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+		region: cfg.Region,
 	}
-
-	// Construct the file URL
-	fileURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", S3_BUCKET, S3_REGION, s3Path)
-	return fileURL, nil
 }
 
-func UploadFileToS3(fileName string, content string, userID string) error {
-	// Convert the string content to bytes
-	buf := bytes.NewBufferString(content)
-	s3Path := "uploads/" + userID + "/" + fileName
-
-	// Upload the file to S3
-	_, err := s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(S3_BUCKET_APP),
-		Key:         aws.String(s3Path),
-		Body:        buf,
-		ContentType: aws.String("text/plain"), // Change as needed
-	})
+// Ping checks the bucket exists and can be accessed
+func (s *S3BlobStore) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
+		return fmt.Errorf("failed to access bucket %s: %w", s.bucket, err)
 	}
-
 	return nil
 }
 
-// DeleteFromS3 deletes a file from S3 given its path and returns an error if any occurs
-func DeleteFromS3(fileName string, userID string) error {
-	// Delete the file from S3
-	s3Path := "uploads/" + userID + "/" + fileName
-	_, err := s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(S3_BUCKET),
-		Key:    aws.String(s3Path),
+// Put uploads the data to S3
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	size := int64(len(data))
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: &size,
+		ContentType:   aws.String(contentType),
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to delete object %s from S3: %v", s3Path, err)
+		return fmt.Errorf("failed to upload file: %w", err)
 	}
 
-	log.Printf("Successfully deleted %s from S3", s3Path)
 	return nil
 }
 
-// DeleteAllFromS3 deletes ALL files from S3 given the folder and returns an error if any occurs
-func DeleteAllFromS3(userID string) error {
-	s3Path := "uploads/" + userID
-	fileContents, err := ListAllInS3(s3Path)
+// Get downloads an object from S3
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%s: %w", key, blobStore.ErrNotFound)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to list objects in folder: %v", err)
+		return nil, fmt.Errorf("failed to get object %s from S3: %w", key, err)
 	}
+	defer output.Body.Close()
 
-	if len(fileContents) == 0 {
-		log.Println("No files found in the specified folder.")
-		return nil
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s from S3: %w", key, err)
 	}
+	return data, nil
+}
 
-	// Step 2: Delete each object
-	for _, key := range fileContents {
-		deleteInput := &s3.DeleteObjectInput{
-			Bucket: aws.String(S3_BUCKET),
-			Key:    aws.String(key),
-		}
-
-		_, err = s3Client.DeleteObject(context.TODO(), deleteInput)
-		if err != nil {
-			return fmt.Errorf("failed to delete object %s: %v", key, err)
-		}
-
-		log.Printf("Successfully deleted: %s\n", key)
+// Delete deletes a file from S3 given its key and returns an error if any occurs
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s from S3: %w", key, err)
 	}
 
-	log.Println("All files in the folder were deleted.")
 	return nil
 }
 
-// ListAllInS3 returns a list of all the items inside the given folder
-func ListAllInS3(folderPath string) ([]string, error) {
+// List returns a list of all the items inside the given folder
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
 	var fileContents []string
-	// List all the objects with the given prefix (folderPath)
-	listInput := &s3.ListObjectsV2Input{
-		Bucket: aws.String(S3_BUCKET),
-		Prefix: aws.String(folderPath),
-	}
-
-	listOutput, err := s3Client.ListObjectsV2(context.TODO(), listInput)
-	if err != nil {
-		return fileContents, fmt.Errorf("failed to list objects in folder: %v", err)
-	}
 
-	for _, item := range listOutput.Contents {
-		fileContents = append(fileContents, *item.Key)
+	// List all the objects with the given prefix, a page at a time
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fileContents, fmt.Errorf("failed to list objects in folder: %w", err)
+		}
+		for _, item := range page.Contents {
+			fileContents = append(fileContents, *item.Key)
+		}
 	}
 	return fileContents, nil
 }
 
-// EditAppJS uploads App.js file to S3
-func EditAppJS(AppJSCode string, userID string) {
-	err := UploadFileToS3("App.js", AppJSCode, userID)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
-	}
-}
-
-// EditAppCSS uploads App.css file to S3
-func EditAppCSS(AppCSSCode string, userID string) {
-	err := UploadFileToS3("App.css", AppCSSCode, userID)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
-	}
+// URL returns the public virtual-hosted-style URL of the object
+func (s *S3BlobStore) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
 }
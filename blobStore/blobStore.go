@@ -0,0 +1,39 @@
+package blobStore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by a BlobStore when no blob exists at the given key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs of data under slash-separated keys, such as "uploads/123/App.js".
+type BlobStore interface {
+	// Put creates or replaces the blob at key.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the contents of the blob at key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the blob at key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys of all blobs beginning with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// URL returns the public URL the blob at key is served from.
+	URL(key string) string
+}
+
+// DeleteAll deletes every blob beginning with prefix
+func DeleteAll(ctx context.Context, store BlobStore, prefix string) error {
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list objects in folder: %w", err)
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package blobStore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore is a BlobStore kept in a directory on disk.
+// It is also an http.Handler serving the blobs, so that it can stand in for a public bucket during development.
+type LocalStore struct {
+	dir     string
+	baseURL string
+	files   http.Handler
+}
+
+// NewLocalStore creates a LocalStore in dir, creating the directory if it does not yet exist.
+// baseURL is the address the store is served from, e.g. "http://localhost:80/blobs/images".
+func NewLocalStore(dir string, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &LocalStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files:   http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+// blobPath returns the file holding the blob at key, refusing keys which would escape the directory
+func (l *LocalStore) blobPath(key string) (string, error) {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Ping checks the directory still exists
+func (l *LocalStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(l.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", l.dir)
+	}
+	return nil
+}
+
+// Put writes the blob to disk. The content type is inferred from the extension when served.
+func (l *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	blobPath, err := l.blobPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := os.WriteFile(blobPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+// Get reads the blob from disk
+func (l *LocalStore) Get(ctx context.Context, key string) ([]byte, error) {
+	blobPath, err := l.blobPath(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(blobPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Delete removes the blob from disk
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	blobPath, err := l.blobPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(blobPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List walks the directory and returns the sorted keys beginning with prefix
+func (l *LocalStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects in folder: %w", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// URL returns the address of the blob under the store's base URL
+func (l *LocalStore) URL(key string) string {
+	return l.baseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// ServeHTTP serves the blobs, with the request path relative to the store's directory
+func (l *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.files.ServeHTTP(w, r)
+}
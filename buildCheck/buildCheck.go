@@ -0,0 +1,79 @@
+package buildCheck
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// Diagnostic is a compile error in one of the app's files.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`   // 1-based
+	Column  int    `json:"column"` // 1-based
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic as "file:line:column: message"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// CompileError is returned when a file is rejected because it does not compile.
+type CompileError struct {
+	File        string
+	Diagnostics []Diagnostic
+}
+
+// Error lists every diagnostic on its own line
+func (e *CompileError) Error() string {
+	lines := []string{fmt.Sprintf("%s does not compile, so it was not saved:", e.File)}
+	for _, diagnostic := range e.Diagnostics {
+		lines = append(lines, diagnostic.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsChecked reports whether files at the path are compiled before being saved
+func IsChecked(filePath string) bool {
+	switch path.Ext(filePath) {
+	case ".js", ".jsx":
+		return true
+	}
+	return false
+}
+
+// CheckFile transforms the JavaScript or JSX code with esbuild, returning a CompileError if it has syntax errors.
+// Files which are not JavaScript are not checked.
+func CheckFile(filePath string, code string) error {
+	if !IsChecked(filePath) {
+		return nil
+	}
+
+	result := api.Transform(code, api.TransformOptions{
+		Loader:     api.LoaderJSX,
+		Sourcefile: filePath,
+		LogLevel:   api.LogLevelSilent,
+	})
+	if len(result.Errors) == 0 {
+		return nil
+	}
+	return &CompileError{File: filePath, Diagnostics: toDiagnostics(filePath, result.Errors)}
+}
+
+// toDiagnostics converts esbuild's messages to Diagnostics, attributing those without a location to filePath
+func toDiagnostics(filePath string, messages []api.Message) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, msg := range messages {
+		diagnostic := Diagnostic{File: filePath, Message: msg.Text}
+		if msg.Location != nil {
+			diagnostic.File = msg.Location.File
+			diagnostic.Line = msg.Location.Line
+			diagnostic.Column = msg.Location.Column + 1
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
@@ -0,0 +1,136 @@
+package buildCheck
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// File every app is built from
+const ENTRY_POINT = "App.js"
+
+// Namespace of the files esbuild loads from memory, rather than from disk
+const PROJECT_NAMESPACE = "project"
+
+// Extensions tried, in order, for imports which leave them out
+var resolveExtensions = []string{"", ".js", ".jsx", ".json", ".css", "/index.js", "/index.jsx"}
+
+// Loaders of the files an app may contain
+var loaders = map[string]api.Loader{
+	".js":   api.LoaderJSX,
+	".jsx":  api.LoaderJSX,
+	".css":  api.LoaderCSS,
+	".json": api.LoaderJSON,
+}
+
+// BoilerplateFiles are the files of the React boilerplate in src besides App.js and App.css.
+// They are part of the app the preview serves, but are not among the files the server keeps, so imports of them are not checked.
+var BoilerplateFiles = map[string]bool{
+	"index.js":           true,
+	"index.css":          true,
+	"logo.svg":           true,
+	"reportWebVitals.js": true,
+	"setupTests.js":      true,
+	"App.test.js":        true,
+}
+
+// Extensions of assets, such as images and fonts, which the app may import but which are not among its files
+var assetExtensions = map[string]bool{
+	".svg":   true,
+	".png":   true,
+	".jpg":   true,
+	".jpeg":  true,
+	".gif":   true,
+	".webp":  true,
+	".avif":  true,
+	".ico":   true,
+	".bmp":   true,
+	".mp3":   true,
+	".mp4":   true,
+	".webm":  true,
+	".wav":   true,
+	".woff":  true,
+	".woff2": true,
+	".ttf":   true,
+	".otf":   true,
+}
+
+// BuildError is returned when an app's files compile one by one, but not together,
+// e.g. because an import names a file or export which does not exist.
+type BuildError struct {
+	Diagnostics []Diagnostic
+}
+
+// Error lists every diagnostic on its own line
+func (e *BuildError) Error() string {
+	lines := []string{"the app does not build:"}
+	for _, diagnostic := range e.Diagnostics {
+		lines = append(lines, diagnostic.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckProject bundles the app starting from App.js, returning a BuildError if it does not build.
+// files maps each path inside src to its code. Imports of packages, of assets and of the boilerplate's files are not checked.
+func CheckProject(files map[string]string) error {
+	result := api.Build(api.BuildOptions{
+		EntryPoints: []string{ENTRY_POINT},
+		Bundle:      true,
+		Write:       false,
+		Outdir:      "build", // needed to bundle CSS imported by JavaScript, though nothing is written
+		LogLevel:    api.LogLevelSilent,
+		Plugins:     []api.Plugin{projectPlugin(files)},
+	})
+	if len(result.Errors) == 0 {
+		return nil
+	}
+	// Hide the namespace from the model, which only knows the files' paths
+	diagnostics := toDiagnostics(ENTRY_POINT, result.Errors)
+	for i := range diagnostics {
+		diagnostics[i].File = strings.TrimPrefix(diagnostics[i].File, PROJECT_NAMESPACE+":")
+		diagnostics[i].Message = strings.ReplaceAll(diagnostics[i].Message, `"`+PROJECT_NAMESPACE+":", `"`)
+	}
+	return &BuildError{Diagnostics: diagnostics}
+}
+
+// projectPlugin makes esbuild read the app's files from memory, and leave packages, assets and the boilerplate's files external
+func projectPlugin(files map[string]string) api.Plugin {
+	return api.Plugin{
+		Name: "project",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if args.Kind == api.ResolveEntryPoint {
+					return api.OnResolveResult{Path: args.Path, Namespace: PROJECT_NAMESPACE}, nil
+				}
+				if !strings.HasPrefix(args.Path, "./") && !strings.HasPrefix(args.Path, "../") {
+					return api.OnResolveResult{Path: args.Path, External: true}, nil
+				}
+
+				target := path.Join(path.Dir(args.Importer), args.Path)
+				for _, ext := range resolveExtensions {
+					if _, exists := files[target+ext]; exists {
+						return api.OnResolveResult{Path: target + ext, Namespace: PROJECT_NAMESPACE}, nil
+					}
+				}
+				if BoilerplateFiles[target] || assetExtensions[strings.ToLower(path.Ext(target))] {
+					return api.OnResolveResult{Path: args.Path, External: true}, nil
+				}
+				return api.OnResolveResult{}, fmt.Errorf("%q does not match any file in src", args.Path)
+			})
+
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: PROJECT_NAMESPACE}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				code, exists := files[args.Path]
+				if !exists {
+					return api.OnLoadResult{}, fmt.Errorf("%s does not exist", args.Path)
+				}
+				loader, ok := loaders[path.Ext(args.Path)]
+				if !ok {
+					loader = api.LoaderText
+				}
+				return api.OnLoadResult{Contents: &code, Loader: loader}, nil
+			})
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package buildCheck
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string // part of the error, or empty if the app builds
+	}{
+		{
+			name: "imports of other files",
+			files: map[string]string{
+				"App.js":               "import './App.css';\nimport Header from './components/Header';\nexport default function App() { return <Header />; }",
+				"App.css":              "body { margin: 0; }",
+				"components/Header.js": "import data from '../data.json';\nexport default function Header() { return <h1>{data.title}</h1>; }",
+				"data.json":            `{"title": "Hello"}`,
+			},
+		},
+		{
+			name: "imports of packages",
+			files: map[string]string{
+				"App.js":  "import React from 'react';\nimport { Button } from 'react-bootstrap';\nexport default function App() { return <Button />; }",
+				"App.css": "",
+			},
+		},
+		{
+			name: "imports of assets and the boilerplate",
+			files: map[string]string{
+				"App.js":  "import logo from './logo.svg';\nimport photo from './uploads/Photo.PNG';\nimport './index.css';\nexport default function App() { return <img src={logo || photo} />; }",
+				"App.css": ".hero { background: url(./images/hero.jpg); }",
+			},
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"App.js":  "import Header from './components/Header';\nexport default function App() { return <Header />; }",
+				"App.css": "",
+			},
+			wantErr: `"./components/Header" does not match any file in src`,
+		},
+		{
+			name: "missing export",
+			files: map[string]string{
+				"App.js":    "import { Footer } from './Footer';\nexport default function App() { return <Footer />; }",
+				"App.css":   "",
+				"Footer.js": "export default function Footer() { return null; }",
+			},
+			wantErr: `No matching export in "Footer.js" for import "Footer"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckProject(test.files)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckProject() = %v, want nil", err)
+				}
+				return
+			}
+
+			var buildErr *BuildError
+			if !errors.As(err, &buildErr) {
+				t.Fatalf("CheckProject() = %v, want a *BuildError", err)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("CheckProject() = %q, want it to contain %q", err, test.wantErr)
+			}
+		})
+	}
+}
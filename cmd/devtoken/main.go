@@ -0,0 +1,88 @@
+// Command devtoken signs tokens for testing the server offline, without Cognito.
+// It creates an RSA key on first use, writes its public half as a JWKS file for AUTH_JWKS_FILE,
+// and prints a token for the user.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	auth "github.com/stephen1cowley/programming-agent-server/auth"
+)
+
+// Key ID of the development key
+const DEV_KEY_ID = "dev"
+
+func main() {
+	user := flag.String("user", "123", "user ID to put in the token")
+	issuer := flag.String("issuer", "http://localhost/dev", "issuer of the token, matching AUTH_ISSUER")
+	audience := flag.String("audience", "dev", "audience of the token, matching AUTH_AUDIENCE")
+	tokenUse := flag.String("tokenUse", "access", "kind of token, matching AUTH_TOKEN_USE")
+	ttl := flag.Duration("ttl", 12*time.Hour, "how long the token is valid for")
+	keyPath := flag.String("key", "data/auth/dev-key.pem", "private key, created if it does not exist")
+	jwksPath := flag.String("jwks", "data/auth/jwks.json", "JWKS file to write, for AUTH_JWKS_FILE")
+	flag.Parse()
+
+	key, err := loadOrCreateKey(*keyPath)
+	if err != nil {
+		log.Fatalf("Error loading the key, %v", err)
+	}
+
+	jwksData, err := auth.MarshalJWKS(DEV_KEY_ID, key)
+	if err != nil {
+		log.Fatalf("Error creating the JWKS, %v", err)
+	}
+	err = os.WriteFile(*jwksPath, jwksData, 0o644)
+	if err != nil {
+		log.Fatalf("Error writing the JWKS, %v", err)
+	}
+
+	now := time.Now()
+	token, err := auth.Sign(map[string]any{
+		"iss":       *issuer,
+		"aud":       *audience,
+		"sub":       *user,
+		"token_use": *tokenUse,
+		"iat":       now.Unix(),
+		"exp":       now.Add(*ttl).Unix(),
+	}, DEV_KEY_ID, key)
+	if err != nil {
+		log.Fatalf("Error signing the token, %v", err)
+	}
+	fmt.Println(token)
+}
+
+// loadOrCreateKey reads the PEM-encoded private key at the path, creating it first if necessary
+func loadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		return key, os.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
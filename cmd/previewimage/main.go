@@ -0,0 +1,41 @@
+// Command previewimage builds the image of the users' preview tasks from ecs.appDir, pushes it to ECR
+// and registers the task definition the server starts each user's preview task from.
+// It reads the same configuration as the server, and must be run on a host with Docker before the first preview is started,
+// and again whenever the image changes. Tasks already running keep the previous image until they are restarted.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	apiAgent "github.com/stephen1cowley/programming-agent-server/apiAgent"
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	awsHandlers "github.com/stephen1cowley/programming-agent-server/awsHandlers"
+)
+
+func main() {
+	conf, err := appConfig.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(conf.AWS.Region))
+	if err != nil {
+		log.Fatalf("Unable to load SDK config, %v", err)
+	}
+
+	taskDefinitionARN, err := awsHandlers.PublishPreviewImage(ctx, cfg, apiAgent.PreviewDeployment(conf))
+	if err != nil {
+		log.Fatalf("Error publishing the preview image, %v", err)
+	}
+	fmt.Println(taskDefinitionARN)
+}
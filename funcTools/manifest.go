@@ -0,0 +1,132 @@
+package funcTools
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Maximum names listed in each part of a file's outline
+const MAX_OUTLINE_ITEMS = 8
+
+// FileInfo summarises one of the app's files, so the model can decide whether to read it.
+type FileInfo struct {
+	Path    string
+	Bytes   int
+	Lines   int
+	Outline string // e.g. "declares Header, NavLink; imports react, react-bootstrap"
+}
+
+// jsDeclaration matches top-level declarations of functions, classes and variables
+var jsDeclaration = regexp.MustCompile(`(?m)^(?:export\s+)?(?:default\s+)?(?:async\s+)?(?:function\*?|class|const|let|var)\s+([A-Za-z_$][\w$]*)`)
+
+// jsImport matches the module of each import statement
+var jsImport = regexp.MustCompile(`(?m)^\s*import\s+(?:[^'"]*?\s+from\s+)?['"]([^'"]+)['"]`)
+
+// cssSelector matches the selectors of rules which start on a new line
+var cssSelector = regexp.MustCompile(`(?m)^([^\s{}@/][^{};]*?)\s*\{`)
+
+// Manifest summarises every file in the app, starting with App.js and App.css
+func (cd DirectoryState) Manifest() []FileInfo {
+	var manifest []FileInfo
+	for _, filePath := range cd.FileNames() {
+		code, _ := cd.ReadFile(filePath)
+		lines := 0
+		if code != "" {
+			lines = strings.Count(strings.TrimSuffix(code, "\n"), "\n") + 1
+		}
+		manifest = append(manifest, FileInfo{
+			Path:    filePath,
+			Bytes:   len(code),
+			Lines:   lines,
+			Outline: outline(filePath, code),
+		})
+	}
+	return manifest
+}
+
+// FormatManifest lists the files in the directory, which is relative to src, or every file if it is empty
+func (cd DirectoryState) FormatManifest(directory string) string {
+	directory = strings.Trim(strings.TrimPrefix(strings.TrimSpace(directory), "src"), "/")
+
+	var lines []string
+	for _, info := range cd.Manifest() {
+		if directory != "" && !strings.HasPrefix(info.Path, directory+"/") {
+			continue
+		}
+		line := fmt.Sprintf("- %s (%d lines, %d bytes)", info.Path, info.Lines, info.Bytes)
+		if info.Outline != "" {
+			line += ": " + info.Outline
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "There are no files in " + directory + "."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// outline briefly describes the contents of a file, or returns "" if there is nothing to summarise
+func outline(filePath string, code string) string {
+	if strings.TrimSpace(code) == "" {
+		return "empty"
+	}
+
+	switch path.Ext(filePath) {
+	case ".js", ".jsx":
+		var parts []string
+		if names := submatches(jsDeclaration, code); len(names) != 0 {
+			parts = append(parts, "declares "+listNames(names))
+		}
+		if modules := submatches(jsImport, code); len(modules) != 0 {
+			parts = append(parts, "imports "+listNames(modules))
+		}
+		return strings.Join(parts, "; ")
+	case ".css":
+		if selectors := submatches(cssSelector, code); len(selectors) != 0 {
+			return "styles " + listNames(selectors)
+		}
+	case ".json":
+		var value any
+		if err := json.Unmarshal([]byte(code), &value); err != nil {
+			return ""
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			var keys []string
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			return "object with keys " + listNames(keys)
+		case []any:
+			return fmt.Sprintf("array of %d items", len(v))
+		}
+	}
+	return ""
+}
+
+// submatches returns the first group of every match of re in s, without duplicates
+func submatches(re *regexp.Regexp, s string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range re.FindAllStringSubmatch(s, -1) {
+		name := strings.Join(strings.Fields(match[1]), " ")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// listNames joins the names with commas, saying how many were left out beyond MAX_OUTLINE_ITEMS
+func listNames(names []string) string {
+	if len(names) <= MAX_OUTLINE_ITEMS {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:MAX_OUTLINE_ITEMS], ", "), len(names)-MAX_OUTLINE_ITEMS)
+}
@@ -0,0 +1,304 @@
+package funcTools
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SearchReplace replaces the only occurrence of Search in a file with Replace.
+type SearchReplace struct {
+	Search  string `json:"search" description:"The exact code to find, with enough surrounding lines to be unique."`
+	Replace string `json:"replace" description:"The code to put in its place."`
+}
+
+// change is a replacement of the bytes [start, end) of a file, found by one edit or hunk
+type change struct {
+	start, end  int
+	replacement string
+	name        string // e.g. "edit 2" or "hunk 1", for error messages
+}
+
+// ApplySearchReplace applies every edit to code, each of which must match exactly one place in the original code.
+// Either all edits are applied, or an error describes every edit that could not be.
+func ApplySearchReplace(code string, edits []SearchReplace) (string, error) {
+	if len(edits) == 0 {
+		return "", fmt.Errorf("no edits were given")
+	}
+
+	var changes []change
+	var problems []string
+	for i, edit := range edits {
+		name := fmt.Sprintf("edit %d", i+1)
+		if edit.Search == "" {
+			problems = append(problems, name+": the search text is empty")
+			continue
+		}
+
+		starts := findAll(code, edit.Search)
+		switch len(starts) {
+		case 0:
+			problems = append(problems, name+": the search text was not found"+nearMatchHint(code, edit.Search))
+		case 1:
+			changes = append(changes, change{
+				start:       starts[0],
+				end:         starts[0] + len(edit.Search),
+				replacement: edit.Replace,
+				name:        name,
+			})
+		default:
+			problems = append(problems, fmt.Sprintf("%s: the search text is ambiguous, matching %d places (lines %s); include more surrounding lines to pick one",
+				name, len(starts), lineList(code, starts)))
+		}
+	}
+	if len(problems) != 0 {
+		return "", fmt.Errorf("no changes were made:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return applyChanges(code, changes)
+}
+
+// hunkHeader matches the header of a unified diff hunk, e.g. "@@ -12,7 +12,8 @@"
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk is one section of a unified diff
+type hunk struct {
+	header   string
+	oldStart int      // 1-based line the hunk applies at, according to the header
+	oldLines []string // context and removed lines
+	newLines []string // context and added lines
+}
+
+// ApplyUnifiedDiff applies a unified diff to code.
+// Each hunk is applied where its header says, or if the file has moved, at the only place its context matches.
+// Either all hunks are applied, or an error describes every hunk that could not be.
+func ApplyUnifiedDiff(code string, diff string) (string, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.SplitAfter(code, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Byte offset of the start of each line, with a final entry for the end of the file
+	offsets := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + len(line)
+	}
+
+	// Lines are added with the file's own line endings
+	eol := "\n"
+	if len(lines) != 0 && strings.HasSuffix(lines[0], "\r\n") {
+		eol = "\r\n"
+	}
+
+	var changes []change
+	var problems []string
+	for i, h := range hunks {
+		name := fmt.Sprintf("hunk %d (%s)", i+1, h.header)
+		at, problem := locateHunk(lines, h)
+		if problem != "" {
+			problems = append(problems, name+": "+problem)
+			continue
+		}
+
+		replacement := strings.Join(h.newLines, eol)
+		end := at + len(h.oldLines)
+		// Keep the line ending of the last replaced line. Inserted lines end in one, unless they are added
+		// at the end of a file without a final newline.
+		endsLine := end > at && strings.HasSuffix(lines[end-1], "\n")
+		if end == at {
+			endsLine = at < len(lines) || at == 0 || strings.HasSuffix(lines[at-1], "\n")
+		}
+		if len(h.newLines) != 0 && endsLine {
+			replacement += eol
+		}
+		// Lines added at the end of a file without a final newline must start on a new line
+		if len(h.newLines) != 0 && at == len(lines) && at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+			replacement = eol + replacement
+		}
+		changes = append(changes, change{
+			start:       offsets[at],
+			end:         offsets[end],
+			replacement: replacement,
+			name:        name,
+		})
+	}
+	if len(problems) != 0 {
+		return "", fmt.Errorf("no changes were made:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return applyChanges(code, changes)
+}
+
+// parseUnifiedDiff reads the hunks of a unified diff, ignoring any file headers
+func parseUnifiedDiff(diff string) ([]hunk, error) {
+	var hunks []hunk
+	var current *hunk
+	for i, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		if match := hunkHeader.FindStringSubmatch(line); match != nil {
+			oldStart, _ := strconv.Atoi(match[1])
+			hunks = append(hunks, hunk{header: match[0], oldStart: oldStart})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			// File headers and anything else before the first hunk
+			continue
+		}
+
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case line == `\ No newline at end of file`:
+		case strings.HasPrefix(line, "-"):
+			current.oldLines = append(current.oldLines, line[1:])
+		case strings.HasPrefix(line, "+"):
+			current.newLines = append(current.newLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case line == "":
+			// Blank context lines often lose their leading space
+			current.oldLines = append(current.oldLines, "")
+			current.newLines = append(current.newLines, "")
+		default:
+			return nil, fmt.Errorf("line %d of the diff is not part of a hunk; each line must start with ' ', '-' or '+'", i+1)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("the diff has no hunks; each must start with a header such as @@ -1,3 +1,4 @@")
+	}
+	return hunks, nil
+}
+
+// locateHunk returns the index of the line the hunk applies at, or a description of why it cannot be applied
+func locateHunk(lines []string, h hunk) (int, string) {
+	if len(h.oldLines) == 0 {
+		// A pure insertion can only be placed by its header
+		at := h.oldStart
+		if at > len(lines) {
+			return 0, fmt.Sprintf("the file only has %d lines", len(lines))
+		}
+		return at, ""
+	}
+
+	// Prefer the position given by the header
+	if h.oldStart >= 1 && linesMatch(lines, h.oldStart-1, h.oldLines) {
+		return h.oldStart - 1, ""
+	}
+
+	var matches []int
+	for at := 0; at+len(h.oldLines) <= len(lines); at++ {
+		if linesMatch(lines, at, h.oldLines) {
+			matches = append(matches, at)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Sprintf("the context and removed lines do not match the file (first expected line: %q)", h.oldLines[0])
+	case 1:
+		return matches[0], ""
+	default:
+		var lineNums []string
+		for _, at := range matches {
+			lineNums = append(lineNums, strconv.Itoa(at+1))
+		}
+		return 0, fmt.Sprintf("the hunk is ambiguous, matching %d places (lines %s) but not line %d from its header",
+			len(matches), strings.Join(lineNums, ", "), h.oldStart)
+	}
+}
+
+// linesMatch reports whether want matches the lines starting at index at, ignoring line endings
+func linesMatch(lines []string, at int, want []string) bool {
+	if at+len(want) > len(lines) {
+		return false
+	}
+	for i, line := range want {
+		if strings.TrimRight(lines[at+i], "\r\n") != line {
+			return false
+		}
+	}
+	return true
+}
+
+// applyChanges makes all the changes to code, which must not overlap
+func applyChanges(code string, changes []change) (string, error) {
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].start < changes[j].start })
+
+	var problems []string
+	for i := 1; i < len(changes); i++ {
+		if changes[i].start < changes[i-1].end {
+			problems = append(problems, fmt.Sprintf("%s conflicts with %s, as they change overlapping code", changes[i].name, changes[i-1].name))
+		}
+	}
+	if len(problems) != 0 {
+		return "", fmt.Errorf("no changes were made:\n%s", strings.Join(problems, "\n"))
+	}
+
+	var result strings.Builder
+	prev := 0
+	for _, c := range changes {
+		result.WriteString(code[prev:c.start])
+		result.WriteString(c.replacement)
+		prev = c.end
+	}
+	result.WriteString(code[prev:])
+	return result.String(), nil
+}
+
+// findAll returns the start of every (possibly overlapping) occurrence of substr in s
+func findAll(s string, substr string) []int {
+	var starts []int
+	for offset := 0; offset <= len(s)-len(substr); {
+		i := strings.Index(s[offset:], substr)
+		if i < 0 {
+			break
+		}
+		starts = append(starts, offset+i)
+		offset += i + 1
+	}
+	return starts
+}
+
+// nearMatchHint suggests where the search text would have matched had its whitespace been right
+func nearMatchHint(code string, search string) string {
+	searchLines := trimmedLines(search)
+	codeLines := trimmedLines(code)
+	for at := 0; at+len(searchLines) <= len(codeLines); at++ {
+		match := true
+		for i, line := range searchLines {
+			if codeLines[at+i] != line {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fmt.Sprintf(" exactly, but it matches line %d if whitespace is ignored; copy the indentation exactly", at+1)
+		}
+	}
+	return "; check it is copied exactly from the current file"
+}
+
+// trimmedLines splits s into lines with their surrounding whitespace removed
+func trimmedLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+// lineList formats the line numbers of the given byte offsets in code
+func lineList(code string, offsets []int) string {
+	var lineNums []string
+	for _, offset := range offsets {
+		lineNums = append(lineNums, strconv.Itoa(strings.Count(code[:offset], "\n")+1))
+	}
+	return strings.Join(lineNums, ", ")
+}
@@ -0,0 +1,299 @@
+package funcTools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	const code = "a\nb\nc\n"
+	tests := []struct {
+		name    string
+		code    string
+		diff    string
+		want    string
+		wantErr string // part of the error, if the diff cannot be applied
+	}{
+		{
+			name: "replace a line",
+			code: code,
+			diff: "--- a/App.js\n+++ b/App.js\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "delete a line",
+			code: code,
+			diff: "@@ -2 +1,0 @@\n-b\n",
+			want: "a\nc\n",
+		},
+		{
+			name: "insert at the start",
+			code: code,
+			diff: "@@ -0,0 +1,2 @@\n+y\n+z\n",
+			want: "y\nz\na\nb\nc\n",
+		},
+		{
+			name: "insert in the middle",
+			code: code,
+			diff: "@@ -1,0 +2 @@\n+z\n",
+			want: "a\nz\nb\nc\n",
+		},
+		{
+			name: "insert at the end",
+			code: code,
+			diff: "@@ -3,0 +4 @@\n+z\n",
+			want: "a\nb\nc\nz\n",
+		},
+		{
+			name:    "insert past the end",
+			code:    code,
+			diff:    "@@ -10,0 +11 @@\n+z\n",
+			wantErr: "the file only has 3 lines",
+		},
+		{
+			name: "insert at the end without a final newline",
+			code: "a\nb\nc",
+			diff: "@@ -3,0 +4 @@\n+z\n",
+			want: "a\nb\nc\nz",
+		},
+		{
+			name: "replace the last line without a final newline",
+			code: "a\nb\nc",
+			diff: "@@ -3 +3 @@\n-c\n\\ No newline at end of file\n+C\n\\ No newline at end of file\n",
+			want: "a\nb\nC",
+		},
+		{
+			name: "CRLF file",
+			code: "a\r\nb\r\nc\r\n",
+			diff: "@@ -1,3 +1,4 @@\n a\n-b\n+B\n+B2\n c\n",
+			want: "a\r\nB\r\nB2\r\nc\r\n",
+		},
+		{
+			name: "CRLF file and diff",
+			code: "a\r\nb\r\nc\r\n",
+			diff: "@@ -2,0 +3 @@\r\n+z\r\n",
+			want: "a\r\nb\r\nz\r\nc\r\n",
+		},
+		{
+			name: "blank context line without its space",
+			code: "a\n\nb\n",
+			diff: "@@ -1,3 +1,3 @@\n a\n\n-b\n+B\n",
+			want: "a\n\nB\n",
+		},
+		{
+			name: "hunk moved, found by its context",
+			code: "a\nb\nc\nd\n",
+			diff: "@@ -7,2 +7,2 @@\n b\n-c\n+C\n",
+			want: "a\nb\nC\nd\n",
+		},
+		{
+			name: "repeated context placed by its header",
+			code: "x\ny\nx\ny\n",
+			diff: "@@ -3,2 +3,2 @@\n x\n-y\n+Y\n",
+			want: "x\ny\nx\nY\n",
+		},
+		{
+			name:    "ambiguous hunk",
+			code:    "x\ny\nx\ny\n",
+			diff:    "@@ -9,2 +9,2 @@\n x\n-y\n+Y\n",
+			wantErr: "the hunk is ambiguous, matching 2 places (lines 1, 3)",
+		},
+		{
+			name:    "context not in the file",
+			code:    code,
+			diff:    "@@ -1,2 +1,2 @@\n a\n-q\n+Q\n",
+			wantErr: `do not match the file (first expected line: "a")`,
+		},
+		{
+			name: "several hunks",
+			code: "a\nb\nc\nd\ne\n",
+			diff: "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -4,2 +4,2 @@\n d\n-e\n+E\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:    "overlapping hunks",
+			code:    code,
+			diff:    "@@ -1,2 +1,2 @@\n a\n-b\n+B\n@@ -2,2 +2,2 @@\n-b\n+X\n c\n",
+			wantErr: "conflicts with hunk 1",
+		},
+		{
+			name:    "one bad hunk stops the others",
+			code:    code,
+			diff:    "@@ -1 +1 @@\n-a\n+A\n@@ -3 +3 @@\n-q\n+Q\n",
+			wantErr: "hunk 2 (@@ -3 +3 @@)",
+		},
+		{
+			name:    "empty diff",
+			code:    code,
+			diff:    "",
+			wantErr: "the diff has no hunks",
+		},
+		{
+			name:    "file headers only",
+			code:    code,
+			diff:    "--- a/App.js\n+++ b/App.js\n",
+			wantErr: "the diff has no hunks",
+		},
+		{
+			name:    "line outside a hunk",
+			code:    code,
+			diff:    "@@ -1 +1 @@\n-a\n+A\nb\n",
+			wantErr: "line 4 of the diff is not part of a hunk",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ApplyUnifiedDiff(test.code, test.diff)
+			checkApplied(t, got, err, test.want, test.wantErr)
+		})
+	}
+}
+
+func TestLocateHunk(t *testing.T) {
+	lines := []string{"a\n", "b\n", "a\n", "b\n", "c"}
+	tests := []struct {
+		name        string
+		hunk        hunk
+		want        int
+		wantProblem string
+	}{
+		{"at its header", hunk{oldStart: 3, oldLines: []string{"a", "b"}}, 2, ""},
+		{"moved", hunk{oldStart: 1, oldLines: []string{"b", "c"}}, 3, ""},
+		{"last line without a newline", hunk{oldStart: 5, oldLines: []string{"c"}}, 4, ""},
+		{"ambiguous", hunk{oldStart: 2, oldLines: []string{"a", "b"}}, 0, "matching 2 places (lines 1, 3) but not line 2"},
+		{"missing", hunk{oldStart: 1, oldLines: []string{"d"}}, 0, "do not match the file"},
+		{"longer than the file", hunk{oldStart: 4, oldLines: []string{"b", "c", "d"}}, 0, "do not match the file"},
+		{"insertion at the start", hunk{oldStart: 0}, 0, ""},
+		{"insertion at the end", hunk{oldStart: 5}, 5, ""},
+		{"insertion past the end", hunk{oldStart: 6}, 0, "the file only has 5 lines"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, problem := locateHunk(lines, test.hunk)
+			if test.wantProblem != "" {
+				if !strings.Contains(problem, test.wantProblem) {
+					t.Errorf("locateHunk() problem = %q, want it to contain %q", problem, test.wantProblem)
+				}
+				return
+			}
+			if problem != "" || got != test.want {
+				t.Errorf("locateHunk() = %d, %q, want %d", got, problem, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	const code = "0123456789"
+	tests := []struct {
+		name    string
+		changes []change
+		want    string
+		wantErr string
+	}{
+		{"no changes", nil, code, ""},
+		{"out of order", []change{{6, 8, "b", "second"}, {1, 3, "a", "first"}}, "0a345b89", ""},
+		{"adjacent", []change{{2, 4, "x", "first"}, {4, 6, "y", "second"}}, "01xy6789", ""},
+		{"insertion", []change{{0, 0, "^", "first"}, {10, 10, "$", "second"}}, "^0123456789$", ""},
+		{"overlapping", []change{{2, 5, "x", "edit 1"}, {4, 6, "y", "edit 2"}}, "", "edit 2 conflicts with edit 1"},
+		{"nested", []change{{1, 9, "x", "edit 1"}, {3, 4, "y", "edit 2"}}, "", "edit 2 conflicts with edit 1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(code, test.changes)
+			checkApplied(t, got, err, test.want, test.wantErr)
+		})
+	}
+}
+
+func TestApplySearchReplace(t *testing.T) {
+	const code = "function App() {\n  return <h1>Hi</h1>;\n}\n\nfunction Footer() {\n  return <p>Hi</p>;\n}\n"
+	tests := []struct {
+		name    string
+		edits   []SearchReplace
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "one edit",
+			edits: []SearchReplace{{Search: "<h1>Hi</h1>", Replace: "<h1>Hello</h1>"}},
+			want:  strings.Replace(code, "<h1>Hi</h1>", "<h1>Hello</h1>", 1),
+		},
+		{
+			name: "several edits",
+			edits: []SearchReplace{
+				{Search: "<p>Hi</p>", Replace: "<p>Bye</p>"},
+				{Search: "function App()", Replace: "function Home()"},
+			},
+			want: strings.Replace(strings.Replace(code, "<p>Hi</p>", "<p>Bye</p>", 1), "function App()", "function Home()", 1),
+		},
+		{
+			name:    "ambiguous edit",
+			edits:   []SearchReplace{{Search: "Hi", Replace: "Hello"}},
+			wantErr: "edit 1: the search text is ambiguous, matching 2 places (lines 2, 6)",
+		},
+		{
+			name:    "missing edit",
+			edits:   []SearchReplace{{Search: "<h2>Hi</h2>", Replace: "<h2>Hello</h2>"}},
+			wantErr: "edit 1: the search text was not found; check it is copied exactly",
+		},
+		{
+			name:    "edit with the wrong indentation",
+			edits:   []SearchReplace{{Search: "function Footer() {\n    return <p>Hi</p>;", Replace: ""}},
+			wantErr: "it matches line 5 if whitespace is ignored",
+		},
+		{
+			name:    "empty search",
+			edits:   []SearchReplace{{Search: "", Replace: "x"}},
+			wantErr: "edit 1: the search text is empty",
+		},
+		{
+			name:    "no edits",
+			wantErr: "no edits were given",
+		},
+		{
+			name: "overlapping edits",
+			edits: []SearchReplace{
+				{Search: "function App() {\n  return", Replace: "x"},
+				{Search: "return <h1>", Replace: "y"},
+			},
+			wantErr: "edit 2 conflicts with edit 1",
+		},
+		{
+			name: "every problem is reported",
+			edits: []SearchReplace{
+				{Search: "Hi", Replace: "Hello"},
+				{Search: "missing", Replace: ""},
+				{Search: "<h1>Hi</h1>", Replace: "<h1>Hello</h1>"},
+			},
+			wantErr: "edit 1: the search text is ambiguous, matching 2 places (lines 2, 6); include more surrounding lines to pick one\nedit 2:",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ApplySearchReplace(code, test.edits)
+			checkApplied(t, got, err, test.want, test.wantErr)
+		})
+	}
+}
+
+// checkApplied checks the result of applying edits, which should fail with an error containing wantErr if it is set
+func checkApplied(t *testing.T, got string, err error, want string, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("got %q, %v, want an error containing %q", got, err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,287 @@
+package funcTools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
+	buildCheck "github.com/stephen1cowley/programming-agent-server/buildCheck"
+)
+
+// Names of the two files every app has, which are kept in their own fields of DirectoryState
+const (
+	APP_JS  = "App.js"
+	APP_CSS = "App.css"
+)
+
+// Maximum number of files in a project, other than App.js and App.css
+const MAX_OTHER_FILES = 50
+
+// Largest file, and largest total of every file, in a project.
+// The files are saved in the user's state, which must fit in a single DynamoDB item of 400 KB along with their conversation.
+const (
+	MAX_FILE_BYTES    = 64 * 1024
+	MAX_PROJECT_BYTES = 192 * 1024
+)
+
+// Extensions of the files the model may create
+var allowedExtensions = map[string]bool{
+	".js":   true,
+	".jsx":  true,
+	".css":  true,
+	".json": true,
+}
+
+// validPath matches relative paths made only of safe characters
+var validPath = regexp.MustCompile(`^[A-Za-z0-9_\-][A-Za-z0-9_.\-]*(/[A-Za-z0-9_\-][A-Za-z0-9_.\-]*)*$`)
+
+// CleanPath checks that filePath names a file the model may create inside the app's src directory, other than the boilerplate's,
+// and returns it relative to src, e.g. "src/components/Header.js" becomes "components/Header.js".
+func CleanPath(filePath string) (string, error) {
+	cleaned := strings.TrimPrefix(strings.TrimSpace(filePath), "src/")
+	if cleaned == "" {
+		return "", errors.New("the file path is empty")
+	}
+	if path.IsAbs(cleaned) || path.Clean(cleaned) != cleaned || !validPath.MatchString(cleaned) {
+		return "", fmt.Errorf("%q is not a valid path inside src; use a relative path such as components/Header.js", filePath)
+	}
+	if !allowedExtensions[path.Ext(cleaned)] {
+		return "", fmt.Errorf("%q must end in .js, .jsx, .css or .json", filePath)
+	}
+	// The boilerplate's own files, such as index.js which renders App, are fixed
+	if buildCheck.BoilerplateFiles[cleaned] {
+		return "", fmt.Errorf("%s is part of the React boilerplate and cannot be changed; use App.js, App.css or a new file instead", cleaned)
+	}
+	return cleaned, nil
+}
+
+// ReadFile returns the code of the file at the cleaned path, and whether it exists
+func (cd DirectoryState) ReadFile(filePath string) (string, bool) {
+	switch filePath {
+	case APP_JS:
+		return cd.AppJSCode, true
+	case APP_CSS:
+		return cd.AppCSSCode, true
+	}
+	for _, file := range cd.OtherFiles {
+		if file.FileName == filePath {
+			return file.FileCode, true
+		}
+	}
+	return "", false
+}
+
+// FileNames returns the paths of every file in the app, starting with App.js and App.css
+func (cd DirectoryState) FileNames() []string {
+	fileNames := []string{APP_JS, APP_CSS}
+	for _, file := range cd.OtherFiles {
+		fileNames = append(fileNames, file.FileName)
+	}
+	return fileNames
+}
+
+// Files returns the code of every file in the app, keyed by path
+func (cd DirectoryState) Files() map[string]string {
+	files := map[string]string{APP_JS: cd.AppJSCode, APP_CSS: cd.AppCSSCode}
+	for _, file := range cd.OtherFiles {
+		files[file.FileName] = file.FileCode
+	}
+	return files
+}
+
+// Size returns the total bytes of code of every file in the app
+func (cd DirectoryState) Size() int {
+	size := len(cd.AppJSCode) + len(cd.AppCSSCode)
+	for _, file := range cd.OtherFiles {
+		size += len(file.FileCode)
+	}
+	return size
+}
+
+// setFile creates or replaces the file at the cleaned path
+func (cd *DirectoryState) setFile(filePath string, code string) {
+	switch filePath {
+	case APP_JS:
+		cd.AppJSCode = code
+		return
+	case APP_CSS:
+		cd.AppCSSCode = code
+		return
+	}
+	for i, file := range cd.OtherFiles {
+		if file.FileName == filePath {
+			cd.OtherFiles[i].FileCode = code
+			return
+		}
+	}
+	cd.OtherFiles = append(cd.OtherFiles, FileState{FileName: filePath, FileCode: code})
+}
+
+// checkRemovable checks that the file at the cleaned path exists and may be deleted
+func (cd DirectoryState) checkRemovable(filePath string) error {
+	if filePath == APP_JS || filePath == APP_CSS {
+		return fmt.Errorf("%s cannot be deleted or renamed", filePath)
+	}
+	if _, exists := cd.ReadFile(filePath); !exists {
+		return fmt.Errorf("%s does not exist", filePath)
+	}
+	return nil
+}
+
+// removeFile deletes the file at the cleaned path
+func (cd *DirectoryState) removeFile(filePath string) error {
+	if err := cd.checkRemovable(filePath); err != nil {
+		return err
+	}
+	for i, file := range cd.OtherFiles {
+		if file.FileName == filePath {
+			cd.OtherFiles = append(cd.OtherFiles[:i], cd.OtherFiles[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Statuses of a FileChange
+const (
+	FILE_UPDATING = "updating"
+	FILE_UPDATED  = "updated"
+	FILE_FAILED   = "failed"
+	FILE_DELETED  = "deleted"
+)
+
+// FileChange reports progress changing one of the project's files.
+type FileChange struct {
+	Path   string
+	Status string
+	Err    error // why the change failed
+}
+
+// Project is a user's app. Its files are kept in the user's DirectoryState,
+// and mirrored to the app-code BlobStore under Prefix, from where they are served to the user's preview.
+// If OnChange is set, it is told about every file which is written or deleted.
+type Project struct {
+	State    *DirectoryState
+	Store    blobStore.BlobStore
+	Prefix   string
+	OnChange func(change FileChange)
+}
+
+// WriteFile validates the path and code, then creates or replaces the file in both the state and the store.
+// JavaScript which does not compile is rejected with a *buildCheck.CompileError.
+func (p *Project) WriteFile(ctx context.Context, filePath string, code string) (string, error) {
+	cleaned, err := CleanPath(filePath)
+	if err != nil {
+		p.notify(FileChange{Path: filePath, Status: FILE_FAILED, Err: err})
+		return "", err
+	}
+
+	p.notify(FileChange{Path: cleaned, Status: FILE_UPDATING})
+	if err := p.saveFile(ctx, cleaned, code); err != nil {
+		p.notify(FileChange{Path: cleaned, Status: FILE_FAILED, Err: err})
+		return cleaned, err
+	}
+	p.notify(FileChange{Path: cleaned, Status: FILE_UPDATED})
+	return cleaned, nil
+}
+
+// saveFile checks the code of the file at the cleaned path, then saves it to both the state and the store
+func (p *Project) saveFile(ctx context.Context, cleaned string, code string) error {
+	if path.Ext(cleaned) == ".json" && !json.Valid([]byte(code)) {
+		return fmt.Errorf("%s is not valid JSON", cleaned)
+	}
+	// Keep the last good version of the file live if the new one would not compile
+	if err := buildCheck.CheckFile(cleaned, code); err != nil {
+		return err
+	}
+
+	if len(code) > MAX_FILE_BYTES {
+		return fmt.Errorf("%s would be %d bytes, more than the maximum of %d; split it into smaller files", cleaned, len(code), MAX_FILE_BYTES)
+	}
+	oldCode, exists := p.State.ReadFile(cleaned)
+	if !exists && len(p.State.OtherFiles) >= MAX_OTHER_FILES {
+		return fmt.Errorf("the app already has the maximum of %d files", MAX_OTHER_FILES+2)
+	}
+	if size := p.State.Size() - len(oldCode) + len(code); size > MAX_PROJECT_BYTES {
+		return fmt.Errorf("the app's files would total %d bytes, more than the maximum of %d; make them shorter or delete the ones which are not used", size, MAX_PROJECT_BYTES)
+	}
+	if err := p.Store.Put(ctx, p.Prefix+cleaned, []byte(code), "text/plain"); err != nil {
+		return fmt.Errorf("%s could not be saved: %w", cleaned, err)
+	}
+	p.State.setFile(cleaned, code)
+	return nil
+}
+
+// DeleteFile removes the file from both the state and the store.
+// It is deleted from the store first, so the state still lists it if the store cannot delete it.
+func (p *Project) DeleteFile(ctx context.Context, filePath string) (string, error) {
+	cleaned, err := CleanPath(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err := p.State.checkRemovable(cleaned); err != nil {
+		return cleaned, err
+	}
+	if err := p.Store.Delete(ctx, p.Prefix+cleaned); err != nil {
+		return cleaned, fmt.Errorf("%s could not be deleted: %w", cleaned, err)
+	}
+	if err := p.State.removeFile(cleaned); err != nil {
+		return cleaned, err
+	}
+	p.notify(FileChange{Path: cleaned, Status: FILE_DELETED})
+	return cleaned, nil
+}
+
+// RenameFile moves the file at from to the new path to, which must not already exist
+func (p *Project) RenameFile(ctx context.Context, from string, to string) (string, string, error) {
+	cleanedFrom, err := CleanPath(from)
+	if err != nil {
+		return "", "", err
+	}
+	cleanedTo, err := CleanPath(to)
+	if err != nil {
+		return cleanedFrom, "", err
+	}
+	code, exists := p.State.ReadFile(cleanedFrom)
+	if !exists {
+		return cleanedFrom, cleanedTo, fmt.Errorf("%s does not exist", cleanedFrom)
+	}
+	if _, exists := p.State.ReadFile(cleanedTo); exists {
+		return cleanedFrom, cleanedTo, fmt.Errorf("%s already exists", cleanedTo)
+	}
+	if cleanedFrom == APP_JS || cleanedFrom == APP_CSS {
+		return cleanedFrom, cleanedTo, fmt.Errorf("%s cannot be deleted or renamed", cleanedFrom)
+	}
+
+	// Write the new file before deleting the old one, so the code is never lost
+	if _, err := p.WriteFile(ctx, cleanedTo, code); err != nil {
+		return cleanedFrom, cleanedTo, err
+	}
+	if _, err := p.DeleteFile(ctx, cleanedFrom); err != nil {
+		return cleanedFrom, cleanedTo, err
+	}
+	return cleanedFrom, cleanedTo, nil
+}
+
+// notify passes the change to OnChange, if it is set
+func (p *Project) notify(change FileChange) {
+	if p.OnChange != nil {
+		p.OnChange(change)
+	}
+}
+
+// DeleteOtherFiles removes every file other than App.js and App.css from the store, e.g. when the app is reset
+func (p *Project) DeleteOtherFiles(ctx context.Context) error {
+	for _, file := range p.State.OtherFiles {
+		if err := p.Store.Delete(ctx, p.Prefix+file.FileName); err != nil {
+			return fmt.Errorf("%s could not be deleted: %w", file.FileName, err)
+		}
+	}
+	p.State.OtherFiles = nil
+	return nil
+}
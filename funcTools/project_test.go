@@ -0,0 +1,144 @@
+package funcTools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	blobStore "github.com/stephen1cowley/programming-agent-server/blobStore"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		filePath string
+		want     string // empty if the path is rejected
+	}{
+		{"App.js", "App.js"},
+		{"src/App.css", "App.css"},
+		{" components/Header.js ", "components/Header.js"},
+		{"data/products.json", "data/products.json"},
+		{"pages/About.jsx", "pages/About.jsx"},
+		{"", ""},
+		{"/etc/passwd.js", ""},
+		{"../secrets.js", ""},
+		{"components/../App.js", ""},
+		{"components//Header.js", ""},
+		{"logo.svg", ""},
+		{"README.md", ""},
+		{"index.js", ""},
+		{"src/index.css", ""},
+		{"reportWebVitals.js", ""},
+		{"setupTests.js", ""},
+		{"App.test.js", ""},
+		{"components/index.js", "components/index.js"},
+	}
+
+	for _, test := range tests {
+		got, err := CleanPath(test.filePath)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("CleanPath(%q) = %q, want an error", test.filePath, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("CleanPath(%q) = %q, %v, want %q", test.filePath, got, err, test.want)
+		}
+	}
+}
+
+// newTestProject creates an empty project whose files are stored in a temporary directory
+func newTestProject(t *testing.T) *Project {
+	t.Helper()
+	store, err := blobStore.NewLocalStore(t.TempDir(), "http://localhost/blobs/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Project{State: &DirectoryState{}, Store: store, Prefix: "uploads/alice/"}
+}
+
+func TestWriteFileLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]int // bytes of each file written before the one tested
+		path    string
+		size    int
+		wantErr string
+	}{
+		{"largest file", nil, "App.css", MAX_FILE_BYTES, ""},
+		{"file too large", nil, "App.css", MAX_FILE_BYTES + 1, "more than the maximum of 65536"},
+		{"app at its limit", map[string]int{"a.css": MAX_FILE_BYTES, "b.css": MAX_FILE_BYTES}, "c.css", MAX_FILE_BYTES, ""},
+		{"app too large", map[string]int{"a.css": MAX_FILE_BYTES, "b.css": MAX_FILE_BYTES}, "c.css", MAX_FILE_BYTES + 1, "more than the maximum"},
+		{"app too large with a new file", map[string]int{"a.css": MAX_FILE_BYTES, "b.css": MAX_FILE_BYTES, "c.css": MAX_FILE_BYTES}, "d.css", 1, "would total 196609 bytes"},
+		{"replacing a file in a full app", map[string]int{"a.css": MAX_FILE_BYTES, "b.css": MAX_FILE_BYTES, "c.css": MAX_FILE_BYTES}, "c.css", 10, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestProject(t)
+			for filePath, size := range test.files {
+				if _, err := p.WriteFile(context.Background(), filePath, strings.Repeat("a", size)); err != nil {
+					t.Fatalf("WriteFile(%s) = %v", filePath, err)
+				}
+			}
+
+			_, err := p.WriteFile(context.Background(), test.path, strings.Repeat("a", test.size))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("WriteFile() = %v, want an error containing %q", err, test.wantErr)
+				}
+				if code, _ := p.State.ReadFile(test.path); len(code) == test.size {
+					t.Errorf("%s was saved despite the error", test.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("WriteFile() = %v, want no error", err)
+			}
+		})
+	}
+}
+
+// failingDeleteStore is a BlobStore which cannot delete anything
+type failingDeleteStore struct {
+	blobStore.BlobStore
+}
+
+func (failingDeleteStore) Delete(ctx context.Context, key string) error {
+	return errors.New("access denied")
+}
+
+func TestDeleteFile(t *testing.T) {
+	p := newTestProject(t)
+	if _, err := p.WriteFile(context.Background(), "a.css", "body {}"); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	// A file which cannot be deleted from the store is kept in the state too
+	store := p.Store
+	p.Store = failingDeleteStore{store}
+	if _, err := p.DeleteFile(context.Background(), "a.css"); err == nil {
+		t.Fatal("DeleteFile() with a failing store = nil, want an error")
+	}
+	if _, exists := p.State.ReadFile("a.css"); !exists {
+		t.Error("a.css was removed from the state, although it is still in the store")
+	}
+
+	p.Store = store
+	if _, err := p.DeleteFile(context.Background(), "a.css"); err != nil {
+		t.Fatalf("DeleteFile() = %v", err)
+	}
+	if _, exists := p.State.ReadFile("a.css"); exists {
+		t.Error("a.css is still in the state")
+	}
+	if _, err := store.Get(context.Background(), p.Prefix+"a.css"); !errors.Is(err, blobStore.ErrNotFound) {
+		t.Errorf("Get(a.css) = %v, want %v", err, blobStore.ErrNotFound)
+	}
+
+	for _, filePath := range []string{"App.js", "missing.css"} {
+		if _, err := p.DeleteFile(context.Background(), filePath); err == nil {
+			t.Errorf("DeleteFile(%s) = nil, want an error", filePath)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package funcTools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+)
+
+// Tool is a function the model may call on the user's app.
+// The exported fields of a Tool are its arguments, which the model's JSON is decoded into before Execute is called.
+// Each field is described to the model by its json, description and enum tags, and is required unless tagged omitempty.
+type Tool interface {
+	Name() string
+	Description() string
+	// Execute makes the call, returning the result to report back to the model
+	Execute(ctx context.Context, p *Project) (string, error)
+}
+
+// ArgumentError is returned when the model calls a tool with arguments which do not fit its schema.
+type ArgumentError struct {
+	Tool string
+	Err  error
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %v", e.Tool, e.Err)
+}
+
+func (e *ArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// registeredTool is a Tool type along with the schema of its arguments
+type registeredTool struct {
+	argsType reflect.Type
+	schema   *jsonschema.Definition
+}
+
+// Registry holds the tools offered to the model, and dispatches its calls to them.
+type Registry struct {
+	tools       map[string]registeredTool
+	definitions []llm.Tool
+}
+
+// NewRegistry generates the schema of each tool's arguments from its fields.
+// The tools are offered to the model in the order given.
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{tools: make(map[string]registeredTool)}
+	for _, tool := range tools {
+		argsType := reflect.TypeOf(tool)
+		if argsType.Kind() == reflect.Pointer {
+			argsType = argsType.Elem()
+		}
+		if _, exists := r.tools[tool.Name()]; exists {
+			return nil, fmt.Errorf("tool %s is registered twice", tool.Name())
+		}
+		schema, err := reflectSchema(argsType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the schema of tool %s: %w", tool.Name(), err)
+		}
+		if schema.Type != jsonschema.Object {
+			return nil, fmt.Errorf("tool %s must be a struct", tool.Name())
+		}
+
+		r.tools[tool.Name()] = registeredTool{argsType: argsType, schema: schema}
+		r.definitions = append(r.definitions, llm.Tool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  schema,
+		})
+	}
+	return r, nil
+}
+
+// Definitions returns the tools to offer the model
+func (r *Registry) Definitions() []llm.Tool {
+	return r.definitions
+}
+
+// Has reports whether a tool of that name is registered
+func (r *Registry) Has(name string) bool {
+	_, exists := r.tools[name]
+	return exists
+}
+
+// Call decodes the JSON arguments into a new instance of the named tool, and executes it.
+// Arguments which do not fit the tool's schema are reported with an *ArgumentError.
+func (r *Registry) Call(ctx context.Context, p *Project, name string, arguments string) (string, error) {
+	registered, exists := r.tools[name]
+	if !exists {
+		return "", fmt.Errorf("there is no tool named %q", name)
+	}
+
+	args := reflect.New(registered.argsType)
+	if err := decodeArgs(arguments, registered.schema, args.Interface()); err != nil {
+		return "", &ArgumentError{Tool: name, Err: err}
+	}
+	return args.Interface().(Tool).Execute(ctx, p)
+}
+
+// decodeArgs decodes the arguments into args, checking that required fields are present and enums have allowed values
+func decodeArgs(arguments string, schema *jsonschema.Definition, args any) error {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &fields); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return fmt.Errorf("the arguments are not valid JSON: %w", err)
+		}
+		return errors.New("the arguments must be a JSON object")
+	}
+	var problems []string
+	for _, required := range schema.Required {
+		if _, exists := fields[required]; !exists {
+			problems = append(problems, fmt.Sprintf("%q is required", required))
+		}
+	}
+	for name, property := range schema.Properties {
+		var value string
+		if len(property.Enum) == 0 || fields[name] == nil || json.Unmarshal(fields[name], &value) != nil {
+			continue
+		}
+		if !slices.Contains(property.Enum, value) {
+			problems = append(problems, fmt.Sprintf("%q must be one of %s, not %q", name, strings.Join(property.Enum, ", "), value))
+		}
+	}
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(arguments)))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(args)
+}
+
+// reflectSchema generates the JSON schema of a Go type, using the json, description and enum tags of struct fields
+func reflectSchema(t reflect.Type) (*jsonschema.Definition, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonschema.Definition{Type: jsonschema.String}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonschema.Definition{Type: jsonschema.Integer}, nil
+	case reflect.Float32, reflect.Float64:
+		return &jsonschema.Definition{Type: jsonschema.Number}, nil
+	case reflect.Bool:
+		return &jsonschema.Definition{Type: jsonschema.Boolean}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := reflectSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &jsonschema.Definition{Type: jsonschema.Array, Items: items}, nil
+	case reflect.Pointer:
+		return reflectSchema(t.Elem())
+	case reflect.Struct:
+		return reflectStructSchema(t)
+	default:
+		return nil, fmt.Errorf("%s fields are not supported", t.Kind())
+	}
+}
+
+// reflectStructSchema generates the JSON schema of an object from the exported fields of a struct
+func reflectStructSchema(t reflect.Type) (*jsonschema.Definition, error) {
+	schema := &jsonschema.Definition{
+		Type:       jsonschema.Object,
+		Properties: make(map[string]jsonschema.Definition),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := reflectSchema(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		property.Description = field.Tag.Get("description")
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property.Enum = strings.Split(enum, ",")
+		}
+		schema.Properties[name] = *property
+
+		if !slices.Contains(strings.Split(options, ","), "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema, nil
+}
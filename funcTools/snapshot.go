@@ -0,0 +1,110 @@
+package funcTools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Snapshot is an immutable copy of every file of an app at a point in time.
+type Snapshot struct {
+	ID         int
+	CreatedAt  time.Time
+	Label      string // what caused the snapshot, e.g. the user's message
+	AppJSCode  string
+	AppCSSCode string
+	OtherFiles []FileState
+}
+
+// TakeSnapshot copies the files of the directory into a new Snapshot
+func (cd DirectoryState) TakeSnapshot(id int, label string) Snapshot {
+	return Snapshot{
+		ID:         id,
+		CreatedAt:  time.Now().UTC(),
+		Label:      label,
+		AppJSCode:  cd.AppJSCode,
+		AppCSSCode: cd.AppCSSCode,
+		OtherFiles: append([]FileState(nil), cd.OtherFiles...),
+	}
+}
+
+// SameFiles reports whether the snapshot holds exactly the files currently in the directory
+func (s Snapshot) SameFiles(cd DirectoryState) bool {
+	if s.AppJSCode != cd.AppJSCode || s.AppCSSCode != cd.AppCSSCode || len(s.OtherFiles) != len(cd.OtherFiles) {
+		return false
+	}
+	for _, file := range s.OtherFiles {
+		code, exists := cd.ReadFile(file.FileName)
+		if !exists || code != file.FileCode {
+			return false
+		}
+	}
+	return true
+}
+
+// Digest returns a hash of the snapshot's files, which two snapshots share only if they hold exactly the same files
+func (s Snapshot) Digest() string {
+	files := append([]FileState{{FileName: APP_JS, FileCode: s.AppJSCode}, {FileName: APP_CSS, FileCode: s.AppCSSCode}}, s.OtherFiles...)
+	sort.Slice(files, func(i, j int) bool { return files[i].FileName < files[j].FileName })
+
+	// Lengths are included so no file's name or code can run into the next
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%d:%s%d:%s", len(file.FileName), file.FileName, len(file.FileCode), file.FileCode)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// FileNames returns the paths of every file in the snapshot, starting with App.js and App.css
+func (s Snapshot) FileNames() []string {
+	fileNames := []string{APP_JS, APP_CSS}
+	for _, file := range s.OtherFiles {
+		fileNames = append(fileNames, file.FileName)
+	}
+	return fileNames
+}
+
+// Restore replaces every file of the project with those in the snapshot, in both the state and the store.
+// Files which are not in the snapshot are deleted, as are App.js and App.css if they are empty,
+// since they were never written and the preview's own boilerplate versions should be served instead.
+func (p *Project) Restore(ctx context.Context, snap Snapshot) error {
+	files := append([]FileState{{FileName: APP_JS, FileCode: snap.AppJSCode}, {FileName: APP_CSS, FileCode: snap.AppCSSCode}}, snap.OtherFiles...)
+	for _, file := range files {
+		if (file.FileName == APP_JS || file.FileName == APP_CSS) && file.FileCode == "" {
+			if err := p.Store.Delete(ctx, p.Prefix+file.FileName); err != nil {
+				return fmt.Errorf("%s could not be deleted: %w", file.FileName, err)
+			}
+			continue
+		}
+		if err := p.Store.Put(ctx, p.Prefix+file.FileName, []byte(file.FileCode), "text/plain"); err != nil {
+			return fmt.Errorf("%s could not be restored: %w", file.FileName, err)
+		}
+	}
+
+	for _, file := range p.State.OtherFiles {
+		if snap.hasOtherFile(file.FileName) {
+			continue
+		}
+		if err := p.Store.Delete(ctx, p.Prefix+file.FileName); err != nil {
+			return fmt.Errorf("%s could not be deleted: %w", file.FileName, err)
+		}
+	}
+
+	p.State.AppJSCode = snap.AppJSCode
+	p.State.AppCSSCode = snap.AppCSSCode
+	p.State.OtherFiles = append([]FileState(nil), snap.OtherFiles...)
+	return nil
+}
+
+// hasOtherFile reports whether the snapshot has a file other than App.js and App.css at the path
+func (s Snapshot) hasOtherFile(filePath string) bool {
+	for _, file := range s.OtherFiles {
+		if file.FileName == filePath {
+			return true
+		}
+	}
+	return false
+}
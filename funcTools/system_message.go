@@ -1,5 +1,7 @@
 package funcTools
 
+import "path"
+
 // Filestate holds a file's name and the code within it
 type FileState struct {
 	FileName string
@@ -15,6 +17,7 @@ type DirectoryState struct {
 }
 
 // CreateSysMsgState formulates a user message to be sent each time to the LLM.
+// Only a manifest of the files is included, as the model reads the code it needs with the read_file tool.
 func (cd DirectoryState) CreateSysMsgState() (sysMsg string) {
 	if len(cd.S3Images) == 0 {
 		sysMsg += "Currently, there are NO images in the S3 folder."
@@ -24,14 +27,24 @@ func (cd DirectoryState) CreateSysMsgState() (sysMsg string) {
 		sysMsg += "\n" + imName
 	}
 	sysMsg += "\n\n"
-	sysMsg += "The current file contents are as follows:\n\n"
-	sysMsg += "`App.js`:\n\n```jsx\n"
-	sysMsg += cd.AppJSCode
-	sysMsg += "\n```css\n\n`App.css`:\n\n```\n"
-	sysMsg += cd.AppCSSCode
-	sysMsg += "\n```"
-	for _, file := range cd.OtherFiles {
-		sysMsg += "\n\n`" + file.FileName + ".js`:\n\n```jsx\n" + file.FileCode + "\n```"
-	}
+	sysMsg += "The app's files are as follows, relative to src. Use read_file to see the code of a file before changing it.\n\n"
+	sysMsg += cd.FormatManifest("")
 	return
 }
+
+// FormatFile returns the code of a file in a markdown code block, as the result of read_file
+func FormatFile(fileName string, code string) string {
+	return "`" + fileName + "`:\n\n```" + codeLanguage(fileName) + "\n" + code + "\n```"
+}
+
+// codeLanguage returns the markdown code block language of the file
+func codeLanguage(fileName string) string {
+	switch path.Ext(fileName) {
+	case ".css":
+		return "css"
+	case ".json":
+		return "json"
+	default:
+		return "jsx"
+	}
+}
@@ -0,0 +1,201 @@
+package funcTools
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tools is every tool offered to the model, in the order they are offered
+var Tools = []Tool{
+	ListFilesTool{},
+	ReadFileTool{},
+	AppJSEditTool{},
+	AppCSSEditTool{},
+	WriteFileTool{},
+	EditFileTool{},
+	RenameFileTool{},
+	DeleteFileTool{},
+}
+
+// ListFilesTool lists the files in src, with a short outline of each.
+type ListFilesTool struct {
+	Directory string `json:"directory,omitempty" description:"Optional directory relative to src to list, e.g. components. Leave empty to list every file."`
+}
+
+func (ListFilesTool) Name() string { return "list_files" }
+
+func (ListFilesTool) Description() string {
+	return "Lists the files in the React website's src directory, with their size and a short outline of what each contains."
+}
+
+func (args ListFilesTool) Execute(ctx context.Context, p *Project) (string, error) {
+	return p.State.FormatManifest(args.Directory), nil
+}
+
+// ReadFileTool returns the code of a file in src.
+type ReadFileTool struct {
+	Path string `json:"path" description:"Path of the file relative to src, e.g. App.js or components/Header.js."`
+}
+
+func (ReadFileTool) Name() string { return "read_file" }
+
+func (ReadFileTool) Description() string {
+	return "Returns the current code of a file in the React website's src directory. Read a file before editing it, and only read the files you need."
+}
+
+func (args ReadFileTool) Execute(ctx context.Context, p *Project) (string, error) {
+	filePath, err := CleanPath(args.Path)
+	if err != nil {
+		return "", err
+	}
+	code, exists := p.State.ReadFile(filePath)
+	if !exists {
+		return "", fmt.Errorf("%s does not exist; use list_files to see the files", filePath)
+	}
+	return FormatFile(filePath, code), nil
+}
+
+// AppJSEditTool replaces the whole of App.js.
+type AppJSEditTool struct {
+	AppJSCode string `json:"appjscode" description:"The new App.js React code of the website. You MUST define a function App() and export default App in this file."`
+}
+
+func (AppJSEditTool) Name() string { return "app_js_edit_func" }
+
+func (AppJSEditTool) Description() string {
+	return "Replaces the App.js code of the React website with the inputted code. For small changes, prefer edit_file."
+}
+
+func (args AppJSEditTool) Execute(ctx context.Context, p *Project) (string, error) {
+	return updated(p.WriteFile(ctx, APP_JS, args.AppJSCode))
+}
+
+// AppCSSEditTool replaces the whole of App.css.
+type AppCSSEditTool struct {
+	AppCSSCode string `json:"appcsscode" description:"The new App.css React code of the website."`
+}
+
+func (AppCSSEditTool) Name() string { return "app_css_edit_func" }
+
+func (AppCSSEditTool) Description() string {
+	return "Replaces the App.css code of the React website with the inputted code. For small changes, prefer edit_file."
+}
+
+func (args AppCSSEditTool) Execute(ctx context.Context, p *Project) (string, error) {
+	return updated(p.WriteFile(ctx, APP_CSS, args.AppCSSCode))
+}
+
+// WriteFileTool creates or replaces any file in src.
+type WriteFileTool struct {
+	Path string `json:"path" description:"Path of the file relative to src, e.g. components/Header.js, pages/About.js, Header.module.css or data/products.json. Must end in .js, .jsx, .css or .json."`
+	Code string `json:"code" description:"The full new contents of the file."`
+}
+
+func (WriteFileTool) Name() string { return "write_file" }
+
+func (WriteFileTool) Description() string {
+	return "Creates a new file in the React website's src directory, or replaces the contents of an existing one. Remember to import new components where they are used."
+}
+
+func (args WriteFileTool) Execute(ctx context.Context, p *Project) (string, error) {
+	return updated(p.WriteFile(ctx, args.Path, args.Code))
+}
+
+// Modes of the edit_file tool
+const (
+	EDIT_MODE_SEARCH_REPLACE = "search_replace"
+	EDIT_MODE_DIFF           = "diff"
+	EDIT_MODE_REPLACE        = "replace"
+)
+
+// EditFileTool changes part of an existing file in src.
+type EditFileTool struct {
+	Path  string          `json:"path" description:"Path of the existing file relative to src, e.g. App.js or components/Header.js."`
+	Mode  string          `json:"mode" enum:"search_replace,diff,replace" description:"search_replace to give edits, diff to give a unified diff, or replace to give the whole new file as code. Only use replace when most of the file changes."`
+	Edits []SearchReplace `json:"edits,omitempty" description:"For search_replace mode: the edits to make. Each search text must be copied exactly from the current file, including indentation, and match only one place in it."`
+	Diff  string          `json:"diff,omitempty" description:"For diff mode: a unified diff of the file, with @@ hunk headers and unchanged context lines."`
+	Code  string          `json:"code,omitempty" description:"For replace mode: the full new contents of the file."`
+}
+
+func (EditFileTool) Name() string { return "edit_file" }
+
+func (EditFileTool) Description() string {
+	return "Changes part of an existing file in the React website's src directory, without resending the rest of it. Prefer this to replacing whole files. If the edit cannot be applied, nothing is changed and the reason is returned."
+}
+
+func (args EditFileTool) Execute(ctx context.Context, p *Project) (string, error) {
+	filePath, err := CleanPath(args.Path)
+	if err != nil {
+		return "", err
+	}
+	code, exists := p.State.ReadFile(filePath)
+	if !exists {
+		return "", fmt.Errorf("%s does not exist; use write_file to create it", filePath)
+	}
+	code, err = args.Apply(code)
+	if err != nil {
+		return "", fmt.Errorf("could not edit %s: %w", filePath, err)
+	}
+	return updated(p.WriteFile(ctx, filePath, code))
+}
+
+// Apply returns the result of making the edits to the current code of the file
+func (args EditFileTool) Apply(code string) (string, error) {
+	switch args.Mode {
+	case EDIT_MODE_SEARCH_REPLACE, "":
+		return ApplySearchReplace(code, args.Edits)
+	case EDIT_MODE_DIFF:
+		return ApplyUnifiedDiff(code, args.Diff)
+	case EDIT_MODE_REPLACE:
+		return args.Code, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q; use %s, %s or %s", args.Mode, EDIT_MODE_SEARCH_REPLACE, EDIT_MODE_DIFF, EDIT_MODE_REPLACE)
+	}
+}
+
+// RenameFileTool renames or moves a file in src.
+type RenameFileTool struct {
+	From string `json:"from" description:"Current path of the file relative to src."`
+	To   string `json:"to" description:"New path of the file relative to src, which must not already exist."`
+}
+
+func (RenameFileTool) Name() string { return "rename_file" }
+
+func (RenameFileTool) Description() string {
+	return "Renames or moves a file in the React website's src directory. App.js and App.css cannot be renamed. Remember to update any imports of the file."
+}
+
+func (args RenameFileTool) Execute(ctx context.Context, p *Project) (string, error) {
+	from, to, err := p.RenameFile(ctx, args.From, args.To)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s was renamed to %s successfully.", from, to), nil
+}
+
+// DeleteFileTool deletes a file from src.
+type DeleteFileTool struct {
+	Path string `json:"path" description:"Path of the file relative to src."`
+}
+
+func (DeleteFileTool) Name() string { return "delete_file" }
+
+func (DeleteFileTool) Description() string {
+	return "Deletes a file from the React website's src directory. App.js and App.css cannot be deleted. Remember to remove any imports of the file."
+}
+
+func (args DeleteFileTool) Execute(ctx context.Context, p *Project) (string, error) {
+	deleted, err := p.DeleteFile(ctx, args.Path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s was deleted successfully.", deleted), nil
+}
+
+// updated reports the result of writing a file back to the model
+func updated(written string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return written + " was updated successfully.", nil
+}
@@ -0,0 +1,67 @@
+package llm
+
+import "context"
+
+// Roles of the participants in a chat
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// ToolCall is a request from the model to call one of the tools it was offered.
+type ToolCall struct {
+	ID        string `json:"ID"`
+	Name      string `json:"Name"`
+	Arguments string `json:"Arguments"` // JSON-encoded arguments
+}
+
+// Message is a single chat message.
+// It is persisted as part of each user's state, so its field names must remain stable.
+type Message struct {
+	Role    string `json:"Role"`
+	Content string `json:"Content"`
+	// ToolCalls are the calls requested by an assistant message
+	ToolCalls []ToolCall `json:"ToolCalls,omitempty"`
+	// ToolCallID is the call a tool message is the result of
+	ToolCallID string `json:"ToolCallID,omitempty"`
+}
+
+// Tool describes a function the model may call.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  any // JSON schema of the arguments object
+}
+
+// Usage counts the tokens consumed by a completion.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Request is a chat completion request.
+type Request struct {
+	Model       string
+	Messages    []Message
+	Tools       []Tool
+	Temperature float32
+}
+
+// Response is the model's reply to a Request.
+type Response struct {
+	Message      Message
+	Usage        Usage
+	FinishReason string
+}
+
+// Provider is a chat completion backend.
+type Provider interface {
+	// Chat returns the model's complete reply.
+	Chat(ctx context.Context, req Request) (*Response, error)
+	// ChatStream returns the same reply as Chat,
+	// but calls onToken with each piece of the reply's content as soon as it is generated.
+	ChatStream(ctx context.Context, req Request, onToken func(string)) (*Response, error)
+}
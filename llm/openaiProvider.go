@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIProvider is a Provider for the OpenAI chat completions API,
+// or for any server implementing it, such as llama.cpp or Ollama.
+type OpenAIProvider struct {
+	client *openai.Client
+}
+
+// NewOpenAI creates a Provider using the OpenAI API.
+// Requests are sent with httpClient, or a default client if it is nil.
+func NewOpenAI(apiKey string, httpClient *http.Client) *OpenAIProvider {
+	cfg := openai.DefaultConfig(apiKey)
+	if httpClient != nil {
+		cfg.HTTPClient = httpClient
+	}
+	return &OpenAIProvider{client: openai.NewClientWithConfig(cfg)}
+}
+
+// NewOpenAICompatible creates a Provider using the OpenAI-compatible API at baseURL, e.g. "http://localhost:11434/v1".
+// Most local servers ignore the API key, so it may be empty.
+func NewOpenAICompatible(baseURL string, apiKey string, httpClient *http.Client) *OpenAIProvider {
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = baseURL
+	if httpClient != nil {
+		cfg.HTTPClient = httpClient
+	}
+	return &OpenAIProvider{client: openai.NewClientWithConfig(cfg)}
+}
+
+// Ping checks the API can be reached with the key, by listing the models
+func (o *OpenAIProvider) Ping(ctx context.Context) error {
+	_, err := o.client.ListModels(ctx)
+	return err
+}
+
+// Chat sends the request to the chat completions endpoint
+func (o *OpenAIProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	resp, err := o.client.CreateChatCompletion(ctx, toOpenAIRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no choices in chat completion response")
+	}
+
+	choice := resp.Choices[0]
+	return &Response{
+		Message:      fromOpenAIMessage(choice.Message),
+		Usage:        fromOpenAIUsage(resp.Usage),
+		FinishReason: string(choice.FinishReason),
+	}, nil
+}
+
+// ChatStream streams the reply from the chat completions endpoint, assembling the tool calls from their fragments
+func (o *OpenAIProvider) ChatStream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	openaiReq := toOpenAIRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := o.client.CreateChatCompletionStream(ctx, openaiReq)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	resp := &Response{Message: Message{Role: RoleAssistant}}
+	var content strings.Builder
+	var toolCalls []ToolCall
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The final chunk carries only the usage
+		if chunk.Usage != nil {
+			resp.Usage = fromOpenAIUsage(*chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			onToken(choice.Delta.Content)
+		}
+		if choice.FinishReason != "" {
+			resp.FinishReason = string(choice.FinishReason)
+		}
+
+		// Each fragment of a tool call is identified by its index, with the ID and name only sent in the first
+		for _, fragment := range choice.Delta.ToolCalls {
+			index := len(toolCalls)
+			if fragment.Index != nil {
+				index = *fragment.Index
+			}
+			for len(toolCalls) <= index {
+				toolCalls = append(toolCalls, ToolCall{})
+			}
+			if fragment.ID != "" {
+				toolCalls[index].ID = fragment.ID
+			}
+			if fragment.Function.Name != "" {
+				toolCalls[index].Name = fragment.Function.Name
+			}
+			toolCalls[index].Arguments += fragment.Function.Arguments
+		}
+	}
+
+	resp.Message.Content = content.String()
+	resp.Message.ToolCalls = toolCalls
+	return resp, nil
+}
+
+// toOpenAIRequest converts a Request to the go-openai request type
+func toOpenAIRequest(req Request) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, toOpenAIMessage(msg))
+	}
+
+	var tools []openai.Tool
+	for _, tool := range req.Tools {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Tools:       tools,
+		Temperature: req.Temperature,
+	}
+}
+
+// toOpenAIMessage converts a Message to the go-openai message type
+func toOpenAIMessage(msg Message) openai.ChatCompletionMessage {
+	out := openai.ChatCompletionMessage{
+		Role:       msg.Role,
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
+	}
+	for _, call := range msg.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, openai.ToolCall{
+			ID:   call.ID,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		})
+	}
+	return out
+}
+
+// fromOpenAIMessage converts a go-openai message to a Message
+func fromOpenAIMessage(msg openai.ChatCompletionMessage) Message {
+	out := Message{
+		Role:       msg.Role,
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
+	}
+	for _, call := range msg.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return out
+}
+
+// fromOpenAIUsage converts go-openai token usage to a Usage
+func fromOpenAIUsage(usage openai.Usage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
@@ -0,0 +1,58 @@
+package llm
+
+import "strings"
+
+// Price is the cost of a model's tokens, in US dollars per million.
+type Price struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// Published prices of well-known models, matched by the longest prefix of the model's name like contextWindows
+var prices = map[string]Price{
+	"gpt-4o":        {PromptPerMillion: 2.50, CompletionPerMillion: 10.00},
+	"gpt-4o-mini":   {PromptPerMillion: 0.15, CompletionPerMillion: 0.60},
+	"gpt-4-turbo":   {PromptPerMillion: 10.00, CompletionPerMillion: 30.00},
+	"gpt-4.1":       {PromptPerMillion: 2.00, CompletionPerMillion: 8.00},
+	"gpt-4.1-mini":  {PromptPerMillion: 0.40, CompletionPerMillion: 1.60},
+	"gpt-4":         {PromptPerMillion: 30.00, CompletionPerMillion: 60.00},
+	"gpt-3.5-turbo": {PromptPerMillion: 0.50, CompletionPerMillion: 1.50},
+	"o1":            {PromptPerMillion: 15.00, CompletionPerMillion: 60.00},
+	"o3":            {PromptPerMillion: 2.00, CompletionPerMillion: 8.00},
+	"o4-mini":       {PromptPerMillion: 1.10, CompletionPerMillion: 4.40},
+}
+
+// ModelPrice returns the price of the model, and whether it is known
+func ModelPrice(model string) (Price, bool) {
+	price, longest, known := Price{}, 0, false
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			price, longest, known = p, len(prefix), true
+		}
+	}
+	return price, known
+}
+
+// Cost returns the cost of the usage in US dollars
+func (p Price) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*p.PromptPerMillion + float64(usage.CompletionTokens)*p.CompletionPerMillion) / 1e6
+}
+
+// Add returns the sum of both usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// EstimateUsage approximates the usage of a request and its response, for providers which do not report it
+func EstimateUsage(req Request, resp *Response) Usage {
+	usage := Usage{
+		PromptTokens:     RequestTokens(req.Messages, req.Tools),
+		CompletionTokens: MessageTokens(resp.Message),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// Script drives a ScriptedProvider. Each reply is chosen by matching the latest user message against the rules in order,
+// falling back to Default when none match.
+// Once the rule's tool calls have been answered, the reply is its FollowUp instead, with no further tool calls.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "match": "(?i)blue",
+//	      "reply": "Your site is now blue!",
+//	      "toolCalls": [{"name": "app_css_edit_func", "arguments": {"appcsscode": "body { background: blue; }"}}],
+//	      "followUp": "Your site now has a blue background."
+//	    }
+//	  ],
+//	  "default": {"reply": "Sorry, I don't know how to do that."}
+//	}
+type Script struct {
+	Rules   []ScriptRule `json:"rules"`
+	Default ScriptRule   `json:"default"`
+}
+
+// ScriptRule is a canned reply, sent when Match (a regular expression) matches the user's text.
+// FollowUp defaults to Reply.
+type ScriptRule struct {
+	Match     string           `json:"match"`
+	Reply     string           `json:"reply"`
+	ToolCalls []ScriptToolCall `json:"toolCalls"`
+	FollowUp  string           `json:"followUp"`
+
+	re *regexp.Regexp
+}
+
+// ScriptToolCall is a tool call made as part of a scripted reply.
+type ScriptToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// wordTokens splits text into words along with the whitespace before them
+var wordTokens = regexp.MustCompile(`\s*\S+|\s+$`)
+
+// ScriptedProvider is a fake Provider which replies deterministically from a Script, for tests and offline development.
+type ScriptedProvider struct {
+	script Script
+
+	mu       sync.Mutex
+	requests []Request
+	calls    int
+}
+
+// NewScriptedProvider creates a ScriptedProvider, compiling the Match expression of each rule
+func NewScriptedProvider(script Script) (*ScriptedProvider, error) {
+	for i := range script.Rules {
+		re, err := regexp.Compile(script.Rules[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match in script rule %d: %w", i, err)
+		}
+		script.Rules[i].re = re
+	}
+	return &ScriptedProvider{script: script}, nil
+}
+
+// LoadScriptedProvider creates a ScriptedProvider from a JSON script file
+func LoadScriptedProvider(path string) (*ScriptedProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal script: %w", err)
+	}
+	return NewScriptedProvider(script)
+}
+
+// Chat replies with the first rule matching the latest user message,
+// or with its follow-up if tool results have been sent since that message
+func (s *ScriptedProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.calls++
+	callNum := s.calls
+	s.mu.Unlock()
+
+	text, answered := lastUserText(req.Messages)
+	rule := s.match(text)
+
+	msg := Message{Role: RoleAssistant, Content: rule.Reply}
+	if answered {
+		msg.Content = rule.FollowUp
+		if msg.Content == "" {
+			msg.Content = rule.Reply
+		}
+		return &Response{Message: msg, FinishReason: "stop"}, nil
+	}
+
+	for i, call := range rule.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+			ID:        fmt.Sprintf("call_%d_%d", callNum, i),
+			Name:      call.Name,
+			Arguments: string(call.Arguments),
+		})
+	}
+
+	finishReason := "stop"
+	if len(msg.ToolCalls) != 0 {
+		finishReason = "tool_calls"
+	}
+	return &Response{Message: msg, FinishReason: finishReason}, nil
+}
+
+// ChatStream replies as Chat does, sending the reply's content a word at a time
+func (s *ScriptedProvider) ChatStream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	resp, err := s.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range wordTokens.FindAllString(resp.Message.Content, -1) {
+		onToken(token)
+	}
+	return resp, nil
+}
+
+// Requests returns every request the provider has received, in order
+func (s *ScriptedProvider) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// match returns the first rule matching text, or the default rule
+func (s *ScriptedProvider) match(text string) ScriptRule {
+	for _, rule := range s.script.Rules {
+		if rule.re.MatchString(text) {
+			return rule
+		}
+	}
+	return s.script.Default
+}
+
+// lastUserText returns the content of the latest user message, and whether any tool results follow it
+func lastUserText(messages []Message) (string, bool) {
+	answered := false
+	for i := len(messages) - 1; i >= 0; i-- {
+		switch messages[i].Role {
+		case RoleUser:
+			return messages[i].Content, answered
+		case RoleTool:
+			answered = true
+		}
+	}
+	return "", answered
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokens each message costs for its role and formatting, on top of its content
+const MESSAGE_OVERHEAD_TOKENS = 4
+
+// Context window of models which are not in contextWindows
+const DEFAULT_CONTEXT_WINDOW = 8192
+
+// Context windows, in tokens, of well-known models. Models are matched by the longest prefix of their name,
+// so dated versions such as "gpt-4o-2024-08-06" share their family's window.
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4.1":       1047576,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+}
+
+// ContextWindow returns the number of tokens the model can read and write in a single request
+func ContextWindow(model string) int {
+	window, longest := DEFAULT_CONTEXT_WINDOW, 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			window, longest = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// EstimateTokens approximates the number of tokens in text, at around four characters per token.
+// It is only accurate enough for budgeting, but works for every model without a tokenizer.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// MessageTokens approximates the tokens of a message, including any tool calls
+func MessageTokens(msg Message) int {
+	tokens := MESSAGE_OVERHEAD_TOKENS + EstimateTokens(msg.Content)
+	for _, call := range msg.ToolCalls {
+		tokens += EstimateTokens(call.Name) + EstimateTokens(call.Arguments)
+	}
+	return tokens
+}
+
+// RequestTokens approximates the prompt tokens of a request with the messages and tools
+func RequestTokens(messages []Message, tools []Tool) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += MessageTokens(msg)
+	}
+	for _, tool := range tools {
+		schema, _ := json.Marshal(tool.Parameters)
+		tokens += EstimateTokens(tool.Name) + EstimateTokens(tool.Description) + EstimateTokens(string(schema))
+	}
+	return tokens
+}
@@ -1,12 +1,29 @@
 package main
 
 import (
-	"fmt"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
 
 	apiAgent "github.com/stephen1cowley/programming-agent-server/apiAgent"
+	appConfig "github.com/stephen1cowley/programming-agent-server/appConfig"
+	appLog "github.com/stephen1cowley/programming-agent-server/appLog"
 )
 
 func main() {
-	fmt.Println("Running API server...")
-	apiAgent.ApiAgent()
+	config, err := appConfig.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if err := appLog.Setup(os.Stdout, config.Log); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	slog.Info("Running API server", "environment", config.Environment, "logLevel", config.Log.Level)
+	apiAgent.ApiAgent(config)
 }
@@ -0,0 +1,83 @@
+package previewTask
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryLauncher is a Launcher which only records the tasks it is asked to start, useful for local development and tests.
+// Its tasks are running as soon as they are started, and are forgotten when the process exits.
+type MemoryLauncher struct {
+	mu    sync.Mutex
+	tasks map[string]*Task
+	next  int
+}
+
+// NewMemoryLauncher creates a MemoryLauncher with no tasks
+func NewMemoryLauncher() *MemoryLauncher {
+	return &MemoryLauncher{tasks: make(map[string]*Task)}
+}
+
+// Start records a running task for the user
+func (m *MemoryLauncher) Start(ctx context.Context, userID string, env map[string]string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next++
+	startedAt := time.Now()
+	task := &Task{
+		ARN:           fmt.Sprintf("local/preview/%s/%d", userID, m.next),
+		UserID:        userID,
+		Status:        STATUS_RUNNING,
+		DesiredStatus: STATUS_RUNNING,
+		CreatedAt:     startedAt,
+		StartedAt:     &startedAt,
+		PublicIP:      "127.0.0.1",
+	}
+	m.tasks[task.ARN] = task
+	return task.ARN, nil
+}
+
+// Stop marks the task as stopped
+func (m *MemoryLauncher) Stop(ctx context.Context, taskARN string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if task, ok := m.tasks[taskARN]; ok && task.DesiredStatus != STATUS_STOPPED {
+		task.Status = STATUS_STOPPED
+		task.DesiredStatus = STATUS_STOPPED
+		task.StoppedReason = reason
+	}
+	return nil
+}
+
+// Describe returns a copy of the task
+func (m *MemoryLauncher) Describe(ctx context.Context, taskARN string) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskARN]
+	if !ok {
+		return nil, fmt.Errorf("task %s: %w", taskARN, ErrTaskNotFound)
+	}
+	described := *task
+	return &described, nil
+}
+
+// List returns copies of the tasks which have not been stopped, oldest first
+func (m *MemoryLauncher) List(ctx context.Context) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []Task
+	for _, task := range m.tasks {
+		if task.DesiredStatus != STATUS_STOPPED {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	return tasks, nil
+}
@@ -0,0 +1,42 @@
+package previewTask
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTaskNotFound is returned by a Launcher when it has no record of a task, e.g. one stopped long ago.
+var ErrTaskNotFound = errors.New("preview task not found")
+
+// Statuses of a task, as reported by ECS
+const (
+	STATUS_PROVISIONING = "PROVISIONING"
+	STATUS_PENDING      = "PENDING"
+	STATUS_RUNNING      = "RUNNING"
+	STATUS_STOPPED      = "STOPPED"
+)
+
+// Task is a container serving a preview of one user's app.
+type Task struct {
+	ARN           string
+	UserID        string // the user the task was started for
+	Status        string // the last status of the task, e.g. PENDING or RUNNING
+	DesiredStatus string // RUNNING, or STOPPED once it is being stopped
+	CreatedAt     time.Time
+	StartedAt     *time.Time
+	StoppedReason string
+	PublicIP      string // the address the preview is served at, once the task's network interface is attached
+}
+
+// Launcher starts and stops the preview tasks of users.
+type Launcher interface {
+	// Start starts a new task for the user, with the environment variables added to its container, returning its ARN.
+	Start(ctx context.Context, userID string, env map[string]string) (string, error)
+	// Stop stops the task, giving the reason. Stopping a task which has already stopped is not an error.
+	Stop(ctx context.Context, taskARN string, reason string) error
+	// Describe returns the current state of the task, or ErrTaskNotFound.
+	Describe(ctx context.Context, taskARN string) (*Task, error)
+	// List returns every task which has not been told to stop, of every user.
+	List(ctx context.Context) ([]Task, error)
+}
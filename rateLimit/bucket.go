@@ -0,0 +1,83 @@
+package rateLimit
+
+import (
+	"sync"
+	"time"
+
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+)
+
+// How often idle buckets are removed
+const SWEEP_INTERVAL = time.Minute
+
+// bucket holds the tokens of one key, as of the last time it was used
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// KeyedLimiter is a token bucket per key, such as a user ID or IP address.
+// Each bucket holds up to Burst tokens and refills at Rate tokens per second, and each request takes one token.
+// Its decisions are counted in the rate_limit_decisions_total metric under its Name.
+type KeyedLimiter struct {
+	Name  string
+	Rate  float64
+	Burst int
+
+	// now tells the time, replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewKeyedLimiter allows perMinute requests a minute for each key, in bursts of up to burst requests
+func NewKeyedLimiter(name string, perMinute float64, burst int) *KeyedLimiter {
+	return &KeyedLimiter{
+		Name:    name,
+		Rate:    perMinute / 60,
+		Burst:   max(burst, 1),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the key's bucket, or returns a *LimitError saying when one will be available
+func (l *KeyedLimiter) Allow(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		appMetrics.ObserveLimit(l.Name, appMetrics.DECISION_REJECTED)
+		wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+		return &LimitError{Limit: l.Name, RetryAfter: wait}
+	}
+	b.tokens--
+	appMetrics.ObserveLimit(l.Name, appMetrics.DECISION_ALLOWED)
+	return nil
+}
+
+// sweep forgets the buckets which have refilled, as they are the same as new ones
+func (l *KeyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < SWEEP_INTERVAL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package rateLimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestLimiter creates a KeyedLimiter telling the time by a fake clock
+func newTestLimiter(perMinute float64, burst int) (*KeyedLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewKeyedLimiter("test", perMinute, burst)
+	l.now = clock.Now
+	return l, clock
+}
+
+// checkAllow checks whether Allow lets the key through, or otherwise asks it to retry after wantRetry
+func checkAllow(t *testing.T, l *KeyedLimiter, key string, wantRetry time.Duration) {
+	t.Helper()
+	err := l.Allow(key)
+	if wantRetry == 0 {
+		if err != nil {
+			t.Fatalf("Allow(%q) = %v, want nil", key, err)
+		}
+		return
+	}
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Allow(%q) = %v, want a *LimitError", key, err)
+	}
+	if limitErr.Limit != "test" || limitErr.RetryAfter != wantRetry {
+		t.Errorf("Allow(%q) = %s limit retrying after %s, want test after %s", key, limitErr.Limit, limitErr.RetryAfter, wantRetry)
+	}
+}
+
+func TestKeyedLimiterBurst(t *testing.T) {
+	l, _ := newTestLimiter(60, 3)
+
+	for i := 0; i < 3; i++ {
+		checkAllow(t, l, "alice", 0)
+	}
+	checkAllow(t, l, "alice", time.Second)
+
+	// Other keys have their own buckets
+	checkAllow(t, l, "bob", 0)
+}
+
+func TestKeyedLimiterRefill(t *testing.T) {
+	l, clock := newTestLimiter(60, 3)
+	for i := 0; i < 3; i++ {
+		checkAllow(t, l, "alice", 0)
+	}
+
+	clock.Advance(400 * time.Millisecond)
+	checkAllow(t, l, "alice", 600*time.Millisecond)
+	clock.Advance(600 * time.Millisecond)
+	checkAllow(t, l, "alice", 0)
+	checkAllow(t, l, "alice", time.Second)
+
+	// The bucket refills no further than the burst
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		checkAllow(t, l, "alice", 0)
+	}
+	checkAllow(t, l, "alice", time.Second)
+}
+
+func TestKeyedLimiterSweep(t *testing.T) {
+	l, clock := newTestLimiter(1, 2)
+	checkAllow(t, l, "idle", 0)
+	checkAllow(t, l, "busy", 0)
+	checkAllow(t, l, "busy", 0)
+
+	// After a minute the idle key has refilled, but the busy one has only one of its two tokens back
+	clock.Advance(SWEEP_INTERVAL)
+	checkAllow(t, l, "new", 0)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("the refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("the bucket still refilling was swept")
+	}
+
+	// Nothing is swept again until another interval has passed
+	clock.Advance(SWEEP_INTERVAL - time.Second)
+	checkAllow(t, l, "other", 0)
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("the bucket was swept before the interval had passed")
+	}
+	clock.Advance(time.Second)
+	checkAllow(t, l, "other", 0)
+	if _, ok := l.buckets["busy"]; ok {
+		t.Error("the refilled bucket was not swept after the next interval")
+	}
+
+	// A swept key starts again with a full bucket
+	checkAllow(t, l, "idle", 0)
+	checkAllow(t, l, "idle", 0)
+	checkAllow(t, l, "idle", time.Minute)
+}
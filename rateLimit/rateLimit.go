@@ -0,0 +1,22 @@
+package rateLimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// LimitError is returned when a request is over a limit.
+type LimitError struct {
+	Limit      string        // name of the limit, e.g. "user"
+	RetryAfter time.Duration // how long to wait before trying again
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit reached, retry after %s", e.Limit, e.RetryAfter)
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, for the Retry-After header
+func (e *LimitError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
@@ -0,0 +1,170 @@
+package rateLimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	appMetrics "github.com/stephen1cowley/programming-agent-server/appMetrics"
+)
+
+// FairSemaphore limits how many calls run at once. Calls waiting for a slot are queued per key,
+// and slots are handed to the keys in turn, so one user's burst of calls cannot starve everyone else.
+// Its decisions and load are exported as metrics under its Name.
+type FairSemaphore struct {
+	Name      string
+	Capacity  int           // most calls running at once
+	MaxQueued int           // most calls waiting, beyond which calls are rejected immediately
+	MaxWait   time.Duration // longest a call waits for a slot before being rejected
+
+	// timer starts the timer of a waiting call, returning its channel and the function stopping it; replaced in tests
+	timer func(d time.Duration) (<-chan time.Time, func() bool)
+
+	mu      sync.Mutex
+	running int
+	waiting map[string][]chan struct{} // waiting calls by key, oldest first
+	keys    []string                   // keys with waiting calls, in the order they will next be served
+	queued  int
+}
+
+// SemaphoreStats is a snapshot of a FairSemaphore's load.
+type SemaphoreStats struct {
+	Capacity    int `json:"capacity"`
+	Running     int `json:"running"`
+	Queued      int `json:"queued"`
+	QueuedUsers int `json:"queuedUsers"`
+}
+
+// NewFairSemaphore lets capacity calls run at once, with up to maxQueued waiting for at most maxWait each
+func NewFairSemaphore(name string, capacity int, maxQueued int, maxWait time.Duration) *FairSemaphore {
+	s := &FairSemaphore{
+		Name:      name,
+		Capacity:  max(capacity, 1),
+		MaxQueued: maxQueued,
+		MaxWait:   maxWait,
+		timer:     newTimer,
+		waiting:   make(map[string][]chan struct{}),
+	}
+	s.observe()
+	return s
+}
+
+// newTimer starts a real timer
+func newTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// Acquire waits for a slot for a call on behalf of the key, which must be given back with Release.
+// If the queue is full or no slot frees up within MaxWait, a *LimitError is returned.
+func (s *FairSemaphore) Acquire(ctx context.Context, key string) error {
+	s.mu.Lock()
+	if s.running < s.Capacity && s.queued == 0 {
+		s.running++
+		s.observe()
+		s.mu.Unlock()
+		appMetrics.ObserveLimit(s.Name, appMetrics.DECISION_ALLOWED)
+		return nil
+	}
+	if s.queued >= s.MaxQueued {
+		s.mu.Unlock()
+		appMetrics.ObserveLimit(s.Name, appMetrics.DECISION_REJECTED)
+		return &LimitError{Limit: s.Name, RetryAfter: s.MaxWait}
+	}
+
+	ready := make(chan struct{})
+	if len(s.waiting[key]) == 0 {
+		s.keys = append(s.keys, key)
+	}
+	s.waiting[key] = append(s.waiting[key], ready)
+	s.queued++
+	s.observe()
+	s.mu.Unlock()
+
+	expired, stop := s.timer(s.MaxWait)
+	defer stop()
+
+	var err error
+	select {
+	case <-ready:
+		appMetrics.ObserveLimit(s.Name, appMetrics.DECISION_ALLOWED)
+		return nil
+	case <-expired:
+		err = &LimitError{Limit: s.Name, RetryAfter: s.MaxWait}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dequeue(key, ready) {
+		// The slot was handed over as the wait ended, so pass it on
+		s.release()
+	}
+	s.observe()
+	appMetrics.ObserveLimit(s.Name, appMetrics.DECISION_REJECTED)
+	return err
+}
+
+// Release gives back a slot, handing it to the next key with a waiting call
+func (s *FairSemaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release()
+	s.observe()
+}
+
+// Stats returns the current load
+func (s *FairSemaphore) Stats() SemaphoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SemaphoreStats{Capacity: s.Capacity, Running: s.running, Queued: s.queued, QueuedUsers: len(s.keys)}
+}
+
+// observe exports the current load as metrics. s.mu must be held.
+func (s *FairSemaphore) observe() {
+	appMetrics.ObserveSemaphore(s.Name, s.Capacity, s.running, s.queued, len(s.keys))
+}
+
+// release hands the slot to the oldest call of the next key, or frees it if nothing is waiting. s.mu must be held.
+func (s *FairSemaphore) release() {
+	if len(s.keys) == 0 {
+		s.running--
+		return
+	}
+
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+	next := s.waiting[key][0]
+	s.waiting[key] = s.waiting[key][1:]
+	if len(s.waiting[key]) == 0 {
+		delete(s.waiting, key)
+	} else {
+		// The key goes to the back of the line for its next call
+		s.keys = append(s.keys, key)
+	}
+	s.queued--
+	close(next)
+}
+
+// dequeue removes a waiting call, returning false if it had already been handed a slot. s.mu must be held.
+func (s *FairSemaphore) dequeue(key string, ready chan struct{}) bool {
+	for i, waiting := range s.waiting[key] {
+		if waiting != ready {
+			continue
+		}
+		s.waiting[key] = append(s.waiting[key][:i], s.waiting[key][i+1:]...)
+		if len(s.waiting[key]) == 0 {
+			delete(s.waiting, key)
+			for j, k := range s.keys {
+				if k == key {
+					s.keys = append(s.keys[:j], s.keys[j+1:]...)
+					break
+				}
+			}
+		}
+		s.queued--
+		return true
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package rateLimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeTimers replaces the timers of a FairSemaphore, so the test decides when waiting calls time out
+type fakeTimers chan chan time.Time
+
+func newFakeTimers(s *FairSemaphore) fakeTimers {
+	timers := make(fakeTimers, 16)
+	s.timer = func(d time.Duration) (<-chan time.Time, func() bool) {
+		expired := make(chan time.Time, 1)
+		timers <- expired
+		return expired, func() bool { return true }
+	}
+	return timers
+}
+
+// expireNext times out the oldest waiting call which has not been timed out yet
+func (timers fakeTimers) expireNext(t *testing.T) {
+	t.Helper()
+	select {
+	case expired := <-timers:
+		expired <- time.Time{}
+	case <-time.After(time.Second):
+		t.Fatal("no call started waiting")
+	}
+}
+
+// acquireAsync calls Acquire in the background, returning the channel its result is sent on
+func acquireAsync(ctx context.Context, s *FairSemaphore, key string) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- s.Acquire(ctx, key) }()
+	return result
+}
+
+// waitQueued waits until the semaphore has want calls queued
+func waitQueued(t *testing.T, s *FairSemaphore, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().Queued != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", s.Stats().Queued, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// awaitResult waits for the result of an Acquire called by acquireAsync
+func awaitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() did not return")
+		return nil
+	}
+}
+
+// checkStats checks the running and queued calls of the semaphore
+func checkStats(t *testing.T, s *FairSemaphore, running int, queued int) {
+	t.Helper()
+	if stats := s.Stats(); stats.Running != running || stats.Queued != queued || stats.QueuedUsers > queued {
+		t.Errorf("stats = %+v, want %d running and %d queued", stats, running, queued)
+	}
+}
+
+func TestFairSemaphoreCapacity(t *testing.T) {
+	s := NewFairSemaphore("test", 2, 0, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.Acquire(ctx, "alice"); err != nil {
+			t.Fatalf("Acquire() = %v, want a slot", err)
+		}
+	}
+	checkStats(t, s, 2, 0)
+
+	s.Release()
+	if err := s.Acquire(ctx, "bob"); err != nil {
+		t.Fatalf("Acquire() after Release() = %v, want a slot", err)
+	}
+	checkStats(t, s, 2, 0)
+}
+
+func TestFairSemaphoreQueueFull(t *testing.T) {
+	s := NewFairSemaphore("test", 1, 1, time.Minute)
+	newFakeTimers(s)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, "alice"); err != nil {
+		t.Fatalf("Acquire() = %v, want a slot", err)
+	}
+	waiting := acquireAsync(ctx, s, "bob")
+	waitQueued(t, s, 1)
+
+	err := s.Acquire(ctx, "carol")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "test" || limitErr.RetryAfter != time.Minute {
+		t.Fatalf("Acquire() with a full queue = %v, want a test *LimitError retrying after a minute", err)
+	}
+	checkStats(t, s, 1, 1)
+
+	s.Release()
+	if err := awaitResult(t, waiting); err != nil {
+		t.Errorf("queued Acquire() = %v, want the released slot", err)
+	}
+	checkStats(t, s, 1, 0)
+}
+
+func TestFairSemaphoreFairness(t *testing.T) {
+	s := NewFairSemaphore("test", 1, 10, time.Minute)
+	newFakeTimers(s)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, "holder"); err != nil {
+		t.Fatalf("Acquire() = %v, want a slot", err)
+	}
+
+	// Alice queues three calls before Bob and Carol queue one each
+	served := make(chan string, 5)
+	for i, key := range []string{"alice", "alice", "alice", "bob", "carol"} {
+		go func() {
+			if err := s.Acquire(ctx, key); err != nil {
+				t.Errorf("Acquire(%s) = %v, want a slot", key, err)
+			}
+			served <- key
+		}()
+		waitQueued(t, s, i+1)
+	}
+
+	var got []string
+	for range 5 {
+		s.Release()
+		select {
+		case key := <-served:
+			got = append(got, key)
+		case <-time.After(time.Second):
+			t.Fatalf("no call was handed the slot after %v", got)
+		}
+	}
+	want := []string{"alice", "bob", "carol", "alice", "alice"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("calls served in the order %v, want %v", got, want)
+		}
+	}
+	checkStats(t, s, 1, 0)
+}
+
+func TestFairSemaphoreTimeout(t *testing.T) {
+	s := NewFairSemaphore("test", 1, 10, time.Minute)
+	timers := newFakeTimers(s)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, "alice"); err != nil {
+		t.Fatalf("Acquire() = %v, want a slot", err)
+	}
+	first := acquireAsync(ctx, s, "bob")
+	waitQueued(t, s, 1)
+	second := acquireAsync(ctx, s, "carol")
+	waitQueued(t, s, 2)
+
+	timers.expireNext(t)
+	var limitErr *LimitError
+	if err := awaitResult(t, first); !errors.As(err, &limitErr) {
+		t.Errorf("timed out Acquire() = %v, want a *LimitError", err)
+	}
+	checkStats(t, s, 1, 1)
+
+	// The call which timed out does not take the slot when it is released
+	s.Release()
+	if err := awaitResult(t, second); err != nil {
+		t.Errorf("queued Acquire() = %v, want the released slot", err)
+	}
+	checkStats(t, s, 1, 0)
+}
+
+func TestFairSemaphoreCancel(t *testing.T) {
+	s := NewFairSemaphore("test", 1, 10, time.Minute)
+	newFakeTimers(s)
+
+	if err := s.Acquire(context.Background(), "alice"); err != nil {
+		t.Fatalf("Acquire() = %v, want a slot", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := acquireAsync(ctx, s, "bob")
+	waitQueued(t, s, 1)
+
+	cancel()
+	if err := awaitResult(t, waiting); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Acquire() = %v, want %v", err, context.Canceled)
+	}
+	checkStats(t, s, 1, 0)
+
+	// With no calls waiting, the slot is freed
+	s.Release()
+	checkStats(t, s, 0, 0)
+}
@@ -1,6 +1,13 @@
 #!/bin/bash
 # Start the server
+# The settings which differ from the defaults are kept on the instance in /home/ubuntu/.env, which the server reads on startup
+# and which is not part of the deployment. It must at least set the token issuer and audience (see scripts/server.env.example).
 cd /home/ubuntu
+for name in AUTH_ISSUER AUTH_AUDIENCE; do
+  if ! grep -Eq "^${name}=.+" /home/ubuntu/.env 2>/dev/null; then
+    echo "$name must be set in /home/ubuntu/.env for the server to start, see scripts/server.env.example" >&2
+    exit 1
+  fi
+done
 sudo nohup /home/ubuntu/server > /home/ubuntu/server.log 2>&1 &
 echo $! > /home/ubuntu/server.pid
-
@@ -1,7 +1,12 @@
 #!/bin/bash
 # Stop the server using the PID file.
+# SIGTERM lets it finish the chat turns in progress, so wait for it to exit (up to its shutdown timeout).
 if [ -f /home/ubuntu/server.pid ]; then
-  kill $(cat /home/ubuntu/server.pid)
+  PID=$(cat /home/ubuntu/server.pid)
+  kill $PID
+  for i in $(seq 1 240); do
+    kill -0 $PID 2>/dev/null || break
+    sleep 1
+  done
   rm /home/ubuntu/server.pid
 fi
-
@@ -1,8 +1,13 @@
 #!/bin/bash
 # Stop any running instance of the server
+# SIGTERM lets it finish the chat turns in progress, so wait for it to exit (up to its shutdown timeout)
 if pgrep -f server > /dev/null; then
   echo "Stopping old server instance..."
   pkill -f server
+  for i in $(seq 1 240); do
+    pgrep -f server > /dev/null || break
+    sleep 1
+  done
 fi
 
 
@@ -1,10 +1,12 @@
 #!/bin/bash
 # Validate if the server is running
-if pgrep -f server > /dev/null; then
+# It exits straight away if its configuration is invalid, so give it a moment and show why if it has stopped
+sleep 5
+if [ -f /home/ubuntu/server.pid ] && kill -0 "$(cat /home/ubuntu/server.pid)" 2>/dev/null; then
   echo "Server is running."
   exit 0
 else
-  echo "Server is not running."
+  echo "Server is not running:"
+  tail -n 20 /home/ubuntu/server.log
   exit 1
 fi
-
@@ -0,0 +1,131 @@
+package userStore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileStore is a UserStore which keeps one JSON file per user inside a directory on disk.
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// NewFileStore creates a FileStore in dir, creating the directory if it does not yet exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create user store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// userPath returns the file holding the given user. The ID is escaped so it can never leave the directory.
+func (f *FileStore) userPath(userID string) string {
+	return filepath.Join(f.dir, url.PathEscape(userID)+".json")
+}
+
+// Ping checks the directory still exists
+func (f *FileStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(f.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", f.dir)
+	}
+	return nil
+}
+
+// GetUser reads the user's JSON file
+func (f *FileStore) GetUser(ctx context.Context, userID string) (*UserState, error) {
+	f.mu.RLock()
+	data, err := os.ReadFile(f.userPath(userID))
+	f.mu.RUnlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("user with ID %s: %w", userID, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user: %w", err)
+	}
+
+	var user UserState
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+// PutUser writes the user's JSON file, replacing it atomically
+func (f *FileStore) PutUser(ctx context.Context, user UserState) error {
+	data, err := json.MarshalIndent(user, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tmp, err := os.CreateTemp(f.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write user: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write user: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.userPath(user.UserID)); err != nil {
+		return fmt.Errorf("failed to write user: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes the user's JSON file
+func (f *FileStore) DeleteUser(ctx context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := os.Remove(f.userPath(userID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// ListUsers returns the sorted IDs of all users with a file in the directory
+func (f *FileStore) ListUsers(ctx context.Context) ([]string, error) {
+	f.mu.RLock()
+	entries, err := os.ReadDir(f.dir)
+	f.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var userIDs []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".tmp-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		userID, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
@@ -0,0 +1,93 @@
+package userStore
+
+import (
+	"errors"
+	"time"
+
+	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+)
+
+// Maximum snapshots kept in each user's history. The oldest are dropped first.
+const MAX_SNAPSHOTS = 15
+
+// Maximum length of a snapshot's label
+const MAX_SNAPSHOT_LABEL = 80
+
+var (
+	ErrNothingToUndo = errors.New("there is nothing to undo")
+	ErrNothingToRedo = errors.New("there is nothing to redo")
+)
+
+// SnapshotInfo describes a snapshot in the user's history.
+// The snapshot's files are kept outside the UserState, so the history does not grow the stored item with every turn.
+type SnapshotInfo struct {
+	ID        int       `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	Label     string    `json:"Label"`
+	Files     []string  `json:"Files"`
+	Digest    string    `json:"Digest"` // the snapshot's funcTools.Snapshot.Digest
+}
+
+// CurrentSnapshot returns the snapshot the user's files were last saved or restored as, if any
+func (u *UserState) CurrentSnapshot() (SnapshotInfo, bool) {
+	if u.SnapshotIndex < 0 || u.SnapshotIndex >= len(u.Snapshots) {
+		return SnapshotInfo{}, false
+	}
+	return u.Snapshots[u.SnapshotIndex], true
+}
+
+// RecordSnapshot adds the user's current files to the history as the newest snapshot, unless they are unchanged since the current one.
+// Any snapshots which had been undone can no longer be redone.
+// It returns the snapshot, whose files must be saved for it to be restored, the IDs of the snapshots dropped from the history,
+// whose files are no longer needed, and whether a snapshot was recorded at all.
+func (u *UserState) RecordSnapshot(label string) (snap funcTools.Snapshot, dropped []int, recorded bool) {
+	if runes := []rune(label); len(runes) > MAX_SNAPSHOT_LABEL {
+		label = string(runes[:MAX_SNAPSHOT_LABEL-3]) + "..."
+	}
+	snap = u.DirectoryState.TakeSnapshot(u.NextSnapshotID+1, label)
+	digest := snap.Digest()
+	if current, ok := u.CurrentSnapshot(); ok && current.Digest == digest {
+		return funcTools.Snapshot{}, nil, false
+	}
+
+	u.NextSnapshotID++
+	if len(u.Snapshots) != 0 {
+		for _, undone := range u.Snapshots[u.SnapshotIndex+1:] {
+			dropped = append(dropped, undone.ID)
+		}
+		u.Snapshots = u.Snapshots[:u.SnapshotIndex+1]
+	}
+	u.Snapshots = append(u.Snapshots, SnapshotInfo{
+		ID:        snap.ID,
+		CreatedAt: snap.CreatedAt,
+		Label:     snap.Label,
+		Files:     snap.FileNames(),
+		Digest:    digest,
+	})
+	if len(u.Snapshots) > MAX_SNAPSHOTS {
+		for _, oldest := range u.Snapshots[:len(u.Snapshots)-MAX_SNAPSHOTS] {
+			dropped = append(dropped, oldest.ID)
+		}
+		u.Snapshots = u.Snapshots[len(u.Snapshots)-MAX_SNAPSHOTS:]
+	}
+	u.SnapshotIndex = len(u.Snapshots) - 1
+	return snap, dropped, true
+}
+
+// Undo moves back the given number of snapshots, returning the snapshot to restore
+func (u *UserState) Undo(steps int) (SnapshotInfo, error) {
+	if steps < 1 || u.SnapshotIndex-steps < 0 || len(u.Snapshots) == 0 {
+		return SnapshotInfo{}, ErrNothingToUndo
+	}
+	u.SnapshotIndex -= steps
+	return u.Snapshots[u.SnapshotIndex], nil
+}
+
+// Redo moves forward the given number of snapshots, returning the snapshot to restore
+func (u *UserState) Redo(steps int) (SnapshotInfo, error) {
+	if steps < 1 || u.SnapshotIndex+steps >= len(u.Snapshots) {
+		return SnapshotInfo{}, ErrNothingToRedo
+	}
+	u.SnapshotIndex += steps
+	return u.Snapshots[u.SnapshotIndex], nil
+}
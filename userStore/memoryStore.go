@@ -0,0 +1,71 @@
+package userStore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a UserStore held entirely in memory, useful for local development and tests.
+// Its contents are lost when the process exits.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[string][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[string][]byte)}
+}
+
+// GetUser returns a copy of the stored user, so callers may freely modify it
+func (m *MemoryStore) GetUser(ctx context.Context, userID string) (*UserState, error) {
+	m.mu.RLock()
+	data, ok := m.users[userID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("user with ID %s: %w", userID, ErrUserNotFound)
+	}
+
+	var user UserState
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+// PutUser stores a copy of the given user
+func (m *MemoryStore) PutUser(ctx context.Context, user UserState) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	m.mu.Lock()
+	m.users[user.UserID] = data
+	m.mu.Unlock()
+	return nil
+}
+
+// DeleteUser removes the user from memory
+func (m *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	delete(m.users, userID)
+	m.mu.Unlock()
+	return nil
+}
+
+// ListUsers returns the sorted IDs of all users in memory
+func (m *MemoryStore) ListUsers(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	userIDs := make([]string, 0, len(m.users))
+	for userID := range m.users {
+		userIDs = append(userIDs, userID)
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
@@ -0,0 +1,125 @@
+package userStore
+
+import (
+	"time"
+
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+)
+
+// Maximum turns kept in each user's usage log, the newest last.
+// Older turns are only counted in the daily totals, which bounds the size of each DynamoDB item.
+const MAX_USAGE_TURNS = 50
+
+// Maximum days of totals kept for each user, enough for a year of monthly totals
+const MAX_USAGE_DAYS = 400
+
+// Layouts of the periods of daily and monthly totals
+const (
+	DAY_LAYOUT   = "2006-01-02"
+	MONTH_LAYOUT = "2006-01"
+)
+
+// TurnUsage is the tokens and estimated cost of a single chat turn.
+type TurnUsage struct {
+	Time             time.Time `json:"time"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	Cost             float64   `json:"cost"` // in US dollars
+}
+
+// UsageTotal is the tokens and estimated cost of every turn in a period, such as a day or month.
+type UsageTotal struct {
+	Period           string  `json:"period"` // formatted with DAY_LAYOUT or MONTH_LAYOUT
+	Turns            int     `json:"turns"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// UsageLog records what a user's turns cost.
+type UsageLog struct {
+	Turns []TurnUsage  `json:"Turns"`
+	Days  []UsageTotal `json:"Days"` // oldest first
+}
+
+// NewTurnUsage prices the usage of a turn with the model
+func NewTurnUsage(at time.Time, model string, usage llm.Usage, price llm.Price) TurnUsage {
+	return TurnUsage{
+		Time:             at.UTC(),
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             price.Cost(usage),
+	}
+}
+
+// RecordUsage adds the turn to the user's usage log and its day's total
+func (u *UserState) RecordUsage(turn TurnUsage) {
+	usage := &u.Usage
+	usage.Turns = append(usage.Turns, turn)
+	if len(usage.Turns) > MAX_USAGE_TURNS {
+		usage.Turns = usage.Turns[len(usage.Turns)-MAX_USAGE_TURNS:]
+	}
+
+	day := turn.Time.UTC().Format(DAY_LAYOUT)
+	if len(usage.Days) == 0 || usage.Days[len(usage.Days)-1].Period != day {
+		usage.Days = append(usage.Days, UsageTotal{Period: day})
+	}
+	usage.Days[len(usage.Days)-1].add(turn)
+	if len(usage.Days) > MAX_USAGE_DAYS {
+		usage.Days = usage.Days[len(usage.Days)-MAX_USAGE_DAYS:]
+	}
+}
+
+// Daily returns the totals of each day with any usage since the given time, oldest first
+func (l UsageLog) Daily(since time.Time) []UsageTotal {
+	from := since.UTC().Format(DAY_LAYOUT)
+	var days []UsageTotal
+	for _, day := range l.Days {
+		if day.Period >= from {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// Monthly returns the totals of each month with any usage, oldest first
+func (l UsageLog) Monthly() []UsageTotal {
+	var months []UsageTotal
+	for _, day := range l.Days {
+		month := day.Period[:len(MONTH_LAYOUT)]
+		if len(months) == 0 || months[len(months)-1].Period != month {
+			months = append(months, UsageTotal{Period: month})
+		}
+		months[len(months)-1].merge(day)
+	}
+	return months
+}
+
+// Month returns the total of the month containing the given time
+func (l UsageLog) Month(at time.Time) UsageTotal {
+	month := at.UTC().Format(MONTH_LAYOUT)
+	for _, total := range l.Monthly() {
+		if total.Period == month {
+			return total
+		}
+	}
+	return UsageTotal{Period: month}
+}
+
+// add counts the turn in the total
+func (t *UsageTotal) add(turn TurnUsage) {
+	t.Turns++
+	t.PromptTokens += turn.PromptTokens
+	t.CompletionTokens += turn.CompletionTokens
+	t.Cost += turn.Cost
+}
+
+// merge adds another total to this one
+func (t *UsageTotal) merge(other UsageTotal) {
+	t.Turns += other.Turns
+	t.PromptTokens += other.PromptTokens
+	t.CompletionTokens += other.CompletionTokens
+	t.Cost += other.Cost
+}
@@ -0,0 +1,57 @@
+package userStore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	funcTools "github.com/stephen1cowley/programming-agent-server/funcTools"
+	llm "github.com/stephen1cowley/programming-agent-server/llm"
+)
+
+// ErrUserNotFound is returned by a UserStore when no state exists for the given UserID.
+var ErrUserNotFound = errors.New("user not found")
+
+// UserState holds the current state for a given user.
+// This includes the current back-and-forth with the AI,
+// as well as the current Directory state.
+type UserState struct {
+	UserID         string                   `json:"UserID"`
+	Messages       []llm.Message            `json:"Messages"`
+	DirectoryState funcTools.DirectoryState `json:"DirectoryState"`
+	FargateTaskARN string                   `json:"FargateTaskARN"`
+	// PreviewActiveAt is when the user was last seen using their preview, to within PREVIEW_ACTIVITY_INTERVAL, so idle tasks can be stopped
+	PreviewActiveAt time.Time `json:"PreviewActiveAt"`
+	// ProjectBrief summarises the earlier messages which were dropped to keep within the model's context window
+	ProjectBrief string `json:"ProjectBrief"`
+	// Snapshots of the files after each turn, oldest first, with SnapshotIndex the one currently live.
+	// Their files are kept in the app-code store.
+	Snapshots      []SnapshotInfo `json:"Snapshots"`
+	SnapshotIndex  int            `json:"SnapshotIndex"`
+	NextSnapshotID int            `json:"NextSnapshotID"`
+	// Usage is what the user's turns have cost, which is kept when their app is reset
+	Usage UsageLog `json:"Usage"`
+}
+
+// UserStore persists UserStates keyed by their UserID.
+type UserStore interface {
+	// GetUser returns the stored state of the user, or ErrUserNotFound.
+	GetUser(ctx context.Context, userID string) (*UserState, error)
+	// PutUser creates or fully replaces the stored state of the user.
+	PutUser(ctx context.Context, user UserState) error
+	// DeleteUser removes the user. Deleting an unknown user is not an error.
+	DeleteUser(ctx context.Context, userID string) error
+	// ListUsers returns the IDs of all stored users.
+	ListUsers(ctx context.Context) ([]string, error)
+}
+
+// Clone returns a copy of the user's state sharing no slices with it, so changing either leaves the other as it was
+func (u UserState) Clone() UserState {
+	u.Messages = append([]llm.Message(nil), u.Messages...)
+	u.DirectoryState.OtherFiles = append([]funcTools.FileState(nil), u.DirectoryState.OtherFiles...)
+	u.DirectoryState.S3Images = append([]string(nil), u.DirectoryState.S3Images...)
+	u.Snapshots = append([]SnapshotInfo(nil), u.Snapshots...)
+	u.Usage.Turns = append([]TurnUsage(nil), u.Usage.Turns...)
+	u.Usage.Days = append([]UsageTotal(nil), u.Usage.Days...)
+	return u
+}